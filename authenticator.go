@@ -0,0 +1,50 @@
+package publisher
+
+import (
+	"net/http"
+)
+
+// Authenticator adds credentials to a request to OneReport.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BasicAuth authenticates with a username and password, using HTTP Basic authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// BearerToken authenticates with an API token, in an Authorization: Bearer header.
+type BearerToken struct {
+	Token string
+}
+
+func (a *BearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// DefaultAPIKeyHeader is the header APIKey uses when Header is empty.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKey authenticates with an API key in a custom header.
+type APIKey struct {
+	// The header name, DefaultAPIKeyHeader if empty
+	Header string
+	Key    string
+}
+
+func (a *APIKey) Authenticate(req *http.Request) error {
+	header := a.Header
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+	req.Header.Set(header, a.Key)
+	return nil
+}
@@ -0,0 +1,112 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/sabhiram/go-gitignore"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MakeBranchMetaChangesets walks the commits reachable from branch, oldest first, and calls
+// callback with a MetaChangeset for each commit. Commits reachable from hideShas are not visited,
+// and commits made before since are skipped (unless since is the zero time).
+func MakeBranchMetaChangesets(
+	branch string,
+	hideShas []string,
+	since time.Time,
+	usePaths bool,
+	remote string,
+	repo *git.Repository,
+	exclude *ignore.GitIgnore,
+	include *ignore.GitIgnore,
+	includeLines bool,
+	options *Options,
+	callback func(*MetaChangeset) error,
+) error {
+	walk, err := repo.Walk()
+	if err != nil {
+		return err
+	}
+	defer walk.Free()
+
+	walk.Sorting(git.SortTopological | git.SortReverse)
+	obj, err := repo.RevparseSingle(branch)
+	if err != nil {
+		return err
+	}
+	head, err := obj.Peel(git.ObjectCommit)
+	if err != nil {
+		return err
+	}
+	err = walk.Push(head.Id())
+	if err != nil {
+		return err
+	}
+	for _, sha := range hideShas {
+		oid, err := git.NewOid(sha)
+		if err != nil {
+			return err
+		}
+		err = walk.Hide(oid)
+		if err != nil {
+			return err
+		}
+	}
+
+	return walkMetaChangesets(walk, usePaths, remote, repo, exclude, include, includeLines, options, func(commit *git.Commit) bool {
+		return since.IsZero() || !commit.Committer().When.Before(since)
+	}, callback)
+}
+
+// BackfillStateFile returns the file in dir that records the last published commit of a backfill
+// of branch. Each branch has its own file, so that backfilling a branch never resumes from the last
+// commit of another one. A symbolic branch such as HEAD is resolved to the branch it points to.
+func BackfillStateFile(dir string, repo *git.Repository, branch string) string {
+	name := branch
+	if ref, err := repo.References.Dwim(branch); err == nil {
+		if resolved, err := ref.Resolve(); err == nil {
+			name = resolved.Name()
+		}
+	}
+	return filepath.Join(dir, "backfill-"+url.PathEscape(name))
+}
+
+// ReadBackfillState returns the sha of the last published commit recorded in stateFile,
+// or an empty string if nothing has been recorded yet.
+func ReadBackfillState(stateFile string) (string, error) {
+	contents, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// WriteBackfillState records sha as the last published commit in stateFile.
+// The file is replaced atomically, so an interrupted backfill never leaves it half written.
+func WriteBackfillState(stateFile string, sha string) error {
+	err := os.MkdirAll(filepath.Dir(stateFile), 0755)
+	if err != nil {
+		return err
+	}
+	// A temporary file of its own, so that concurrent backfills never write to the same one
+	tmp, err := os.CreateTemp(filepath.Dir(stateFile), filepath.Base(stateFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(sha + "\n")
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), stateFile)
+}
@@ -0,0 +1,88 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMakeBranchMetaChangesets(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-changeset-publisher.git"
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+
+	var shas []string
+	err = MakeBranchMetaChangesets(
+		"082022d1a8bac6a768b0fc9243f3f37ede8c0fc3",
+		[]string{"1ae2aabbcdd11948403578a4f2dd32911cc48a00"},
+		time.Time{},
+		true,
+		remote,
+		repo,
+		nil,
+		nil,
+		false,
+		nil,
+		func(changeset *MetaChangeset) error {
+			shas = append(shas, changeset.Sha)
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"e57bfde5c3591a14c0e199c900174a08b0b94312",
+		"082022d1a8bac6a768b0fc9243f3f37ede8c0fc3",
+	}, shas)
+}
+
+func TestBackfillState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "one-report", "backfill")
+
+	sha, err := ReadBackfillState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "", sha)
+
+	err = WriteBackfillState(stateFile, "e57bfde5c3591a14c0e199c900174a08b0b94312")
+	assert.NoError(t, err)
+
+	sha, err = ReadBackfillState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "e57bfde5c3591a14c0e199c900174a08b0b94312", sha)
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(stateFile))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestBackfillStateFileIsPerBranch(t *testing.T) {
+	repo, err := git.InitRepository(t.TempDir(), true)
+	assert.NoError(t, err)
+	commit := commitFile(t, repo, "a.txt", "a\n")
+	_, err = repo.CreateBranch("main", commit, true)
+	assert.NoError(t, err)
+	_, err = repo.CreateBranch("feature/x", commit, true)
+	assert.NoError(t, err)
+	dir := t.TempDir()
+
+	mainFile := BackfillStateFile(dir, repo, "main")
+	featureFile := BackfillStateFile(dir, repo, "feature/x")
+	assert.Equal(t, filepath.Join(dir, "backfill-refs%2Fheads%2Fmain"), mainFile)
+	assert.Equal(t, filepath.Join(dir, "backfill-refs%2Fheads%2Ffeature%2Fx"), featureFile)
+
+	err = WriteBackfillState(mainFile, commit.Id().String())
+	assert.NoError(t, err)
+	sha, err := ReadBackfillState(featureFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "", sha)
+
+	// HEAD is keyed by the branch it points to, so switching branches switches state files
+	assert.NoError(t, repo.SetHead("refs/heads/main"))
+	assert.Equal(t, mainFile, BackfillStateFile(dir, repo, "HEAD"))
+	assert.NoError(t, repo.SetHead("refs/heads/feature/x"))
+	assert.Equal(t, featureFile, BackfillStateFile(dir, repo, "HEAD"))
+}
@@ -0,0 +1,76 @@
+package publisher
+
+import (
+	"bytes"
+	"github.com/libgit2/git2go/v33"
+)
+
+// sniffLength is how many bytes at the start of a blob git looks at to tell whether it is binary.
+const sniffLength = 8000
+
+// isBinary returns whether either side of a change is a binary file. It uses libgit2's binary
+// detection when the diff has already made it, and sniffs the blob contents otherwise. Only the
+// start of the blobs of an oversized change is sniffed, so they are not loaded.
+func isBinary(repo *git.Repository, odb *git.Odb, file git.DiffDelta, oversized bool) (bool, error) {
+	if file.Flags&git.DiffFlagBinary != 0 {
+		return true, nil
+	}
+	if file.Flags&git.DiffFlagNotBinary != 0 {
+		return false, nil
+	}
+	for _, diffFile := range []git.DiffFile{file.OldFile, file.NewFile} {
+		if diffFile.Flags&git.DiffFlagExists == 0 {
+			continue
+		}
+		if diffFile.Flags&git.DiffFlagBinary != 0 {
+			return true, nil
+		}
+		if diffFile.Flags&git.DiffFlagNotBinary != 0 {
+			continue
+		}
+		var binary bool
+		var err error
+		if oversized {
+			binary, err = blobStartIsBinary(repo, odb, diffFile.Oid)
+		} else {
+			binary, err = blobIsBinary(repo, diffFile.Oid)
+		}
+		if err != nil || binary {
+			return binary, err
+		}
+	}
+	return false, nil
+}
+
+func blobIsBinary(repo *git.Repository, oid *git.Oid) (bool, error) {
+	blob, err := repo.LookupBlob(oid)
+	if err != nil {
+		return false, err
+	}
+	return blob.IsBinary(), nil
+}
+
+// blobStartIsBinary returns whether a blob is binary the way git tells, by looking for a NUL byte
+// in its first sniffLength bytes. The blob is streamed from the object database when possible, but
+// libgit2 cannot stream packed objects, which are loaded instead.
+func blobStartIsBinary(repo *git.Repository, odb *git.Odb, oid *git.Oid) (bool, error) {
+	stream, err := odb.NewReadStream(oid)
+	if err != nil {
+		return blobIsBinary(repo, oid)
+	}
+	defer stream.Free()
+	length := stream.Size
+	if length > sniffLength {
+		length = sniffLength
+	}
+	// OdbReadStream.Read reports the length of the buffer rather than the number of bytes read, so
+	// read exactly the bytes to sniff
+	start := make([]byte, length)
+	if length > 0 {
+		_, err = stream.Read(start)
+		if err != nil {
+			return false, err
+		}
+	}
+	return bytes.IndexByte(start, 0) >= 0, nil
+}
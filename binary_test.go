@@ -0,0 +1,43 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIsBinaryUsesDiffFlags(t *testing.T) {
+	binary, err := isBinary(nil, nil, git.DiffDelta{Flags: git.DiffFlagBinary}, false)
+	assert.NoError(t, err)
+	assert.True(t, binary)
+
+	binary, err = isBinary(nil, nil, git.DiffDelta{Flags: git.DiffFlagNotBinary}, false)
+	assert.NoError(t, err)
+	assert.False(t, binary)
+
+	binary, err = isBinary(nil, nil, git.DiffDelta{
+		OldFile: git.DiffFile{Flags: git.DiffFlagExists | git.DiffFlagNotBinary},
+		NewFile: git.DiffFile{Flags: git.DiffFlagExists | git.DiffFlagBinary},
+	}, false)
+	assert.NoError(t, err)
+	assert.True(t, binary)
+}
+
+func TestIsBinarySniffsBlobs(t *testing.T) {
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	oid, err := git.NewOid("1ae2aabbcdd11948403578a4f2dd32911cc48a00")
+	assert.NoError(t, err)
+	commit, err := repo.LookupCommit(oid)
+	assert.NoError(t, err)
+	tree, err := commit.Tree()
+	assert.NoError(t, err)
+	entry, err := tree.EntryByPath("testdata/a.txt")
+	assert.NoError(t, err)
+
+	binary, err := isBinary(repo, nil, git.DiffDelta{
+		NewFile: git.DiffFile{Path: "testdata/a.txt", Oid: entry.Id, Flags: git.DiffFlagExists},
+	}, false)
+	assert.NoError(t, err)
+	assert.False(t, binary)
+}
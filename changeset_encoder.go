@@ -0,0 +1,89 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ChangesetEncoder is a changeset that Publish can post: a *MetaChangeset, or a *MetaChangesetStream
+// which encodes its changes as they are computed.
+type ChangesetEncoder interface {
+	// IdempotencyKey identifies the changeset (see IdempotencyKey)
+	IdempotencyKey() string
+	// Encode writes the changeset to w as JSON
+	Encode(w io.Writer) error
+}
+
+func (c *MetaChangeset) IdempotencyKey() string {
+	return IdempotencyKey(c)
+}
+
+func (c *MetaChangeset) Encode(w io.Writer) error {
+	return json.NewEncoder(w).Encode(c)
+}
+
+// encodeStreaming writes the same JSON as MetaChangeset.Encode, but makes the changes while writing
+// them. header holds the fields before the changes, and makeChanges calls emit with each change
+// and returns the changeset with the fields after the changes.
+func encodeStreaming(w io.Writer, header *MetaChangeset, makeChanges func(emit func(Change) error) (*MetaChangeset, error)) error {
+	prefix, _, err := splitAtChanges(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(prefix)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	changeset, err := makeChanges(func(change Change) error {
+		if n > 0 {
+			_, err := w.Write([]byte{','})
+			if err != nil {
+				return err
+			}
+		}
+		n++
+		bytes, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, suffix, err := splitAtChanges(changeset)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(suffix)
+	return err
+}
+
+// changesPlaceholder is how the changes of a changeset without changes are encoded.
+var changesPlaceholder = []byte(`"changes":[]`)
+
+// splitAtChanges encodes changeset without its changes, and splits the JSON in the middle of the
+// changes array. Splitting the encoded changeset keeps the fields in the same order, and with the
+// same omissions, as MetaChangeset.Encode.
+func splitAtChanges(changeset *MetaChangeset) ([]byte, []byte, error) {
+	withoutChanges := *changeset
+	withoutChanges.Changes = []Change{}
+	buf := new(bytes.Buffer)
+	err := withoutChanges.Encode(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded := buf.Bytes()
+	i := bytes.Index(encoded, changesPlaceholder)
+	if i < 0 {
+		return nil, nil, fmt.Errorf("no changes in %s", encoded)
+	}
+	split := i + len(changesPlaceholder) - 1
+	return encoded[:split], encoded[split:], nil
+}
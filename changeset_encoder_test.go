@@ -0,0 +1,57 @@
+package publisher
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEncodeStreaming(t *testing.T) {
+	changeset := &MetaChangeset{
+		Remote:   "some-remote",
+		UnixTime: 1644410531,
+		OldShas:  []string{"aaa"},
+		Sha:      "bbb",
+		Changes: []Change{
+			{OldSha: "aaa", OldPath: "a.txt", NewPath: "a.txt", LineMappings: [][]int{{0, 0}, {1, -1}}},
+			{OldSha: "aaa", OldPath: "", NewPath: "b.png", LineMappings: [][]int{}, Binary: true},
+		},
+		Loc:        9876,
+		Files:      31,
+		CommentLoc: 12,
+		Languages:  map[string]LanguageFeatures{"Go": {Loc: 9876, Files: 31}},
+	}
+	expected := new(bytes.Buffer)
+	assert.NoError(t, changeset.Encode(expected))
+
+	for _, changes := range [][]Change{changeset.Changes, {}} {
+		expected.Reset()
+		withChanges := *changeset
+		withChanges.Changes = changes
+		assert.NoError(t, withChanges.Encode(expected))
+
+		actual := new(bytes.Buffer)
+		err := encodeStreaming(actual, &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{"aaa"}, Sha: "bbb"}, func(emit func(Change) error) (*MetaChangeset, error) {
+			for _, change := range changes {
+				err := emit(change)
+				if err != nil {
+					return nil, err
+				}
+			}
+			trailer := *changeset
+			trailer.Changes = nil
+			return &trailer, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, expected.String(), actual.String())
+	}
+}
+
+func TestEncodeStreamingWithError(t *testing.T) {
+	actual := new(bytes.Buffer)
+	err := encodeStreaming(actual, &MetaChangeset{}, func(emit func(Change) error) (*MetaChangeset, error) {
+		return nil, errors.New("diff failed")
+	})
+	assert.EqualError(t, err, "diff failed")
+}
@@ -0,0 +1,91 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReadMetaChangeset reads a changeset in the JSON format MetaChangeset.Encode writes. Unknown fields,
+// trailing data and invalid changesets (see MetaChangeset.Validate) are errors, so a file that is
+// not a changeset is not published as an empty one.
+func ReadMetaChangeset(r io.Reader) (*MetaChangeset, error) {
+	decoder := newChangesetDecoder(r)
+	changeset, err := decodeMetaChangeset(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the changeset")
+	}
+	return changeset, nil
+}
+
+// ReadMetaChangesets reads one or more changesets, one after the other, such as the changesets
+// printed one per line in -range mode. Each changeset is read like ReadMetaChangeset, and an empty
+// input is an error.
+func ReadMetaChangesets(r io.Reader) ([]*MetaChangeset, error) {
+	decoder := newChangesetDecoder(r)
+	var changesets []*MetaChangeset
+	for len(changesets) == 0 || decoder.More() {
+		changeset, err := decodeMetaChangeset(decoder)
+		if err == io.EOF {
+			return nil, errors.New("no changeset")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("changeset %d: %w", len(changesets)+1, err)
+		}
+		changesets = append(changesets, changeset)
+	}
+	return changesets, nil
+}
+
+// ReadMetaChangesetFile reads a changeset from a file, see ReadMetaChangeset.
+func ReadMetaChangesetFile(path string) (*MetaChangeset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	changeset, err := ReadMetaChangeset(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return changeset, nil
+}
+
+// ReadMetaChangesetsFile reads changesets from a file, see ReadMetaChangesets.
+func ReadMetaChangesetsFile(path string) ([]*MetaChangeset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	changesets, err := ReadMetaChangesets(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return changesets, nil
+}
+
+func newChangesetDecoder(r io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	return decoder
+}
+
+// decodeMetaChangeset decodes the next changeset, and validates it.
+func decodeMetaChangeset(decoder *json.Decoder) (*MetaChangeset, error) {
+	changeset := &MetaChangeset{}
+	err := decoder.Decode(changeset)
+	if err != nil {
+		return nil, err
+	}
+	err = changeset.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return changeset, nil
+}
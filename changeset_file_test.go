@@ -0,0 +1,82 @@
+package publisher
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadMetaChangeset(t *testing.T) {
+	changeset := &MetaChangeset{
+		Remote:   "some-remote",
+		UnixTime: 1644410531,
+		OldShas:  []string{"ad2c70149ccc529ab26588cde2af1312e6aa0c06"},
+		Sha:      "1ae2aabbcdd11948403578a4f2dd32911cc48a00",
+		Changes:  []Change{{OldSha: "ad2c70149ccc529ab26588cde2af1312e6aa0c06", OldPath: "a.txt", NewPath: "a.txt", LineMappings: [][]int{{0, 0}}}},
+		Loc:      9876,
+		Files:    31,
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, changeset.Encode(buf))
+
+	read, err := ReadMetaChangeset(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, changeset, read)
+}
+
+func TestReadMetaChangesetWithUnknownField(t *testing.T) {
+	_, err := ReadMetaChangeset(strings.NewReader(`{"remote":"r","sha":"1ae2aabbcdd11948403578a4f2dd32911cc48a00","changes":[{"fromPath":"a.txt"}]}`))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "fromPath")
+	}
+}
+
+func TestReadMetaChangesetWithMissingFields(t *testing.T) {
+	_, err := ReadMetaChangeset(strings.NewReader(`{"remote":"r","oldShas":[],"changes":[]}`))
+	assert.EqualError(t, err, "missing sha")
+	_, err = ReadMetaChangeset(strings.NewReader(`{"remote":"r","oldShas":[],"sha":"1ae2aabbcdd11948403578a4f2dd32911cc48a00"}`))
+	assert.EqualError(t, err, "missing changes")
+}
+
+func TestReadMetaChangesetWithTrailingData(t *testing.T) {
+	_, err := ReadMetaChangeset(strings.NewReader(`{"remote":"r","oldShas":[],"sha":"1ae2aabbcdd11948403578a4f2dd32911cc48a00","changes":[]} {}`))
+	assert.Error(t, err)
+}
+
+func TestReadMetaChangesetFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changeset.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"remote":"r","oldShas":[],"changes":[]}`), 0644))
+
+	_, err := ReadMetaChangesetFile(path)
+	assert.EqualError(t, err, path+": missing sha")
+}
+
+func TestReadMetaChangesets(t *testing.T) {
+	first := &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "ad2c70149ccc529ab26588cde2af1312e6aa0c06", Changes: []Change{}}
+	second := &MetaChangeset{Remote: "some-remote", UnixTime: 1644410600, OldShas: []string{"ad2c70149ccc529ab26588cde2af1312e6aa0c06"}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}}
+	buf := new(bytes.Buffer)
+	for _, changeset := range []*MetaChangeset{first, second} {
+		assert.NoError(t, changeset.Encode(buf))
+		buf.WriteString("\n")
+	}
+
+	changesets, err := ReadMetaChangesets(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []*MetaChangeset{first, second}, changesets)
+
+	// A single indented changeset, as printed without -range
+	changesets, err = ReadMetaChangesets(strings.NewReader("{\n  \"remote\": \"r\",\n  \"oldShas\": [],\n  \"sha\": \"1ae2aabbcdd11948403578a4f2dd32911cc48a00\",\n  \"changes\": []\n}\n"))
+	assert.NoError(t, err)
+	assert.Len(t, changesets, 1)
+}
+
+func TestReadMetaChangesetsWithInvalidChangeset(t *testing.T) {
+	_, err := ReadMetaChangesets(strings.NewReader(`{"remote":"r","oldShas":[],"sha":"1ae2aabbcdd11948403578a4f2dd32911cc48a00","changes":[]}` + "\n" + `{"remote":"r","oldShas":[],"changes":[]}`))
+	assert.EqualError(t, err, "changeset 2: missing sha")
+
+	_, err = ReadMetaChangesets(strings.NewReader(" \n"))
+	assert.EqualError(t, err, "no changeset")
+}
@@ -0,0 +1,111 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Refresher is implemented by authenticators whose credentials can expire. When OneReport
+// responds with 401 Unauthorized, Publish calls Refresh and retries the request once.
+type Refresher interface {
+	Refresh() error
+}
+
+// ClientCredentials authenticates as a service account, with an access token fetched from
+// TokenURL using the OAuth2 client credentials grant. The token is cached until it expires.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// The client used to fetch tokens, http.DefaultClient if nil
+	Client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// expiryMargin is how long before its expiry a token is fetched again, so it does not expire in flight.
+const expiryMargin = 30 * time.Second
+
+func (a *ClientCredentials) Authenticate(req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == "" || (!a.expiry.IsZero() && time.Now().Add(expiryMargin).After(a.expiry)) {
+		err := a.fetchToken()
+		if err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+// Refresh discards the cached token, so the next request fetches a new one.
+func (a *ClientCredentials) Refresh() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = ""
+	return nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (a *ClientCredentials) fetchToken() error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return transientError{err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("token request failed: %s", res.Status)
+		if retryable(res, nil) {
+			err = transientError{err}
+		}
+		return err
+	}
+	token := &tokenResponse{}
+	err = json.NewDecoder(res.Body).Decode(token)
+	if err != nil {
+		return err
+	}
+	if token.AccessToken == "" {
+		return errors.New("token response has no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return fmt.Errorf("unsupported token type %q", token.TokenType)
+	}
+	a.token = token.AccessToken
+	a.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		a.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return nil
+}
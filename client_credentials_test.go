@@ -0,0 +1,103 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newTokenServer returns a stub token endpoint issuing token-1, token-2, ... to client "ci" with secret "secret".
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		clientId, clientSecret, ok := req.BasicAuth()
+		if !ok || clientId != "ci" || clientSecret != "secret" {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "client_credentials", req.PostForm.Get("grant_type"))
+		assert.Equal(t, "changesets:write", req.PostForm.Get("scope"))
+		n := atomic.AddInt32(&issued, 1)
+		res.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(res).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+// newOneReportServer returns a stub OneReport that only accepts the given token.
+func newOneReportServer(t *testing.T, token *string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer "+*token {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = res.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientCredentialsCachesToken(t *testing.T) {
+	tokenServer, issued := newTokenServer(t, 3600)
+	validToken := "token-1"
+	server := newOneReportServer(t, &validToken)
+	authenticator := &ClientCredentials{TokenURL: tokenServer.URL, ClientID: "ci", ClientSecret: "secret", Scopes: []string{"changesets:write"}}
+
+	for i := 0; i < 3; i++ {
+		txt, err := Publish(&MetaChangeset{}, "org", server.URL, authenticator, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", txt)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(issued))
+}
+
+func TestClientCredentialsRefreshesTokenOnUnauthorized(t *testing.T) {
+	tokenServer, issued := newTokenServer(t, 3600)
+	validToken := "token-1"
+	server := newOneReportServer(t, &validToken)
+	authenticator := &ClientCredentials{TokenURL: tokenServer.URL, ClientID: "ci", ClientSecret: "secret", Scopes: []string{"changesets:write"}}
+
+	_, err := Publish(&MetaChangeset{}, "org", server.URL, authenticator, nil)
+	assert.NoError(t, err)
+
+	// Revoke token-1
+	validToken = "token-2"
+	txt, err := Publish(&MetaChangeset{}, "org", server.URL, authenticator, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+	assert.Equal(t, int32(2), atomic.LoadInt32(issued))
+}
+
+func TestClientCredentialsFetchesTokenWhenExpired(t *testing.T) {
+	// Expires within expiryMargin, so every request fetches a new token
+	tokenServer, issued := newTokenServer(t, 1)
+	authenticator := &ClientCredentials{TokenURL: tokenServer.URL, ClientID: "ci", ClientSecret: "secret", Scopes: []string{"changesets:write"}}
+
+	for i := 1; i <= 2; i++ {
+		validToken := fmt.Sprintf("token-%d", i)
+		server := newOneReportServer(t, &validToken)
+		_, err := Publish(&MetaChangeset{}, "org", server.URL, authenticator, nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(issued))
+}
+
+func TestClientCredentialsWithWrongSecret(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, 3600)
+	authenticator := &ClientCredentials{TokenURL: tokenServer.URL, ClientID: "ci", ClientSecret: "wrong"}
+
+	_, err := Publish(&MetaChangeset{}, "org", "http://localhost", authenticator, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "token request failed")
+	}
+}
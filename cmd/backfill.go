@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/SmartBear/one-report-changeset-publisher"
+	"github.com/libgit2/git2go/v33"
+	"path/filepath"
+	"time"
+)
+
+func doBackfill(args []string) error {
+	flagSet := flag.NewFlagSet("backfill", flag.ExitOnError)
+	flags := addPublishFlags(flagSet)
+	optionsFlags := addOptionsFlags(flagSet)
+	remote := flagSet.String("remote", "", "Git remote (default is the origin remote in .git/config)")
+	branch := flagSet.String("branch", "HEAD", "Branch to backfill")
+	startSha := flagSet.String("start-sha", "", "First revision to publish (default is the first commit on the branch)")
+	sinceDate := flagSet.String("since", "", "Only publish commits made on or after this date (YYYY-MM-DD)")
+	stateFile := flagSet.String("state-file", "", "File recording the last published revision (default is a file per branch in .git/one-report)")
+	usePaths := flagSet.Bool("use-paths", false, "Use file paths instead of hashed paths")
+	dir := addDirFlag(flagSet)
+	addConfigFlag(flagSet)
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = flags.checkPasswordFlag(flagSet)
+	if err != nil {
+		return err
+	}
+	err = configure(flagSet)
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.OpenRepository(*dir)
+	if err != nil {
+		return err
+	}
+	options, exclude, include, err := optionsFlags.options(repo)
+	if err != nil {
+		return err
+	}
+	if *stateFile == "" {
+		*stateFile = publisher.BackfillStateFile(filepath.Join(repo.Path(), "one-report"), repo, *branch)
+	}
+
+	var since time.Time
+	if *sinceDate != "" {
+		since, err = time.Parse("2006-01-02", *sinceDate)
+		if err != nil {
+			return err
+		}
+	}
+
+	lastSha, err := publisher.ReadBackfillState(*stateFile)
+	if err != nil {
+		return err
+	}
+	var hideShas []string
+	if lastSha != "" {
+		hideShas = append(hideShas, lastSha)
+	} else if *startSha != "" {
+		oid, err := git.NewOid(*startSha)
+		if err != nil {
+			return err
+		}
+		startCommit, err := repo.LookupCommit(oid)
+		if err != nil {
+			return err
+		}
+		for i := uint(0); i < startCommit.ParentCount(); i++ {
+			hideShas = append(hideShas, startCommit.ParentId(i).String())
+		}
+	}
+
+	// Once a changeset is queued, the state file is no longer advanced, so that the next backfill
+	// resumes from the last published commit even if the queued changeset is never published
+	queued := false
+	return publisher.MakeBranchMetaChangesets(*branch, hideShas, since, *usePaths, *remote, repo, exclude, include, true, options, func(metaChangeset *publisher.MetaChangeset) error {
+		txt, changesetQueued, err := flags.publish(metaChangeset)
+		if err != nil {
+			return err
+		}
+		fmt.Println(txt)
+		queued = queued || changesetQueued
+		if queued {
+			return nil
+		}
+		return publisher.WriteBackfillState(*stateFile, metaChangeset.Sha)
+	})
+}
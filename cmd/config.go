@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"github.com/SmartBear/one-report-changeset-publisher"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// addConfigFlag adds the -config flag, for the config file read by configure.
+func addConfigFlag(flagSet *flag.FlagSet) {
+	flagSet.String("config", "", "Config file (default is .onereport.yml in -dir, or in the current directory)")
+}
+
+// addDirFlag adds the -dir flag, for the git repository to read.
+func addDirFlag(flagSet *flag.FlagSet) *string {
+	return flagSet.String("dir", ".", "Git repository directory")
+}
+
+// configure sets the flags that were not given on the command line, from ONE_REPORT_* environment
+// variables (e.g. ONE_REPORT_ORGANIZATION_ID for -organization-id), or else from the config file.
+// The precedence is: command line flags, environment variables, config file, flag defaults.
+func configure(flagSet *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// -dir and -config locate the config file, so they cannot be set in it
+	for _, name := range []string{"dir", "config"} {
+		if flagSet.Lookup(name) == nil || explicit[name] {
+			continue
+		}
+		if value, ok := os.LookupEnv(envName(name)); ok {
+			err := flagSet.Set(name, value)
+			if err != nil {
+				return err
+			}
+			explicit[name] = true
+		}
+	}
+
+	config, err := publisher.LoadConfig(configPath(flagSet))
+	if err != nil {
+		return err
+	}
+	configValues := config.Values()
+
+	var setErr error
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || setErr != nil {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			setErr = flagSet.Set(f.Name, value)
+			return
+		}
+		for _, value := range configValues[f.Name] {
+			setErr = flagSet.Set(f.Name, value)
+			if setErr != nil {
+				return
+			}
+		}
+	})
+	return setErr
+}
+
+// configPath returns the config file to read: -config if it is set, or else .onereport.yml in -dir
+// if the flag set has one, or else .onereport.yml in the current directory.
+func configPath(flagSet *flag.FlagSet) string {
+	if path := flagSet.Lookup("config").Value.String(); path != "" {
+		return path
+	}
+	dir := "."
+	if f := flagSet.Lookup("dir"); f != nil {
+		dir = f.Value.String()
+	}
+	return filepath.Join(dir, ".onereport.yml")
+}
+
+// envName returns the environment variable for a flag, e.g. ONE_REPORT_ORGANIZATION_ID for organization-id.
+func envName(flagName string) string {
+	return "ONE_REPORT_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
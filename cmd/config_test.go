@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newConfigFlagSet(withDir bool) (*flag.FlagSet, *string) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	organizationId := flagSet.String("organization-id", "", "OneReport organization id")
+	if withDir {
+		addDirFlag(flagSet)
+	}
+	addConfigFlag(flagSet)
+	return flagSet, organizationId
+}
+
+func writeConfig(t *testing.T, path string, organizationId string) {
+	err := os.WriteFile(path, []byte("organization-id: "+organizationId+"\n"), 0644)
+	assert.NoError(t, err)
+}
+
+func TestConfigureFromConfigFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "one-report.yml")
+	writeConfig(t, path, "from-flag")
+	flagSet, organizationId := newConfigFlagSet(false)
+
+	assert.NoError(t, flagSet.Parse([]string{"-config", path}))
+	assert.NoError(t, configure(flagSet))
+	assert.Equal(t, "from-flag", *organizationId)
+}
+
+func TestConfigureFromConfigEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "one-report.yml")
+	writeConfig(t, path, "from-env")
+	t.Setenv("ONE_REPORT_CONFIG", path)
+	flagSet, organizationId := newConfigFlagSet(false)
+
+	assert.NoError(t, flagSet.Parse(nil))
+	assert.NoError(t, configure(flagSet))
+	assert.Equal(t, "from-env", *organizationId)
+}
+
+func TestConfigureFromConfigInDir(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, filepath.Join(dir, ".onereport.yml"), "from-dir")
+	flagSet, organizationId := newConfigFlagSet(true)
+
+	assert.NoError(t, flagSet.Parse([]string{"-dir", dir}))
+	assert.NoError(t, configure(flagSet))
+	assert.Equal(t, "from-dir", *organizationId)
+}
+
+func TestConfigurePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, filepath.Join(dir, ".onereport.yml"), "from-dir")
+	t.Setenv("ONE_REPORT_DIR", dir)
+
+	flagSet, organizationId := newConfigFlagSet(true)
+	assert.NoError(t, flagSet.Parse(nil))
+	assert.NoError(t, configure(flagSet))
+	assert.Equal(t, "from-dir", *organizationId)
+
+	t.Setenv("ONE_REPORT_ORGANIZATION_ID", "from-env")
+	flagSet, organizationId = newConfigFlagSet(true)
+	assert.NoError(t, flagSet.Parse(nil))
+	assert.NoError(t, configure(flagSet))
+	assert.Equal(t, "from-env", *organizationId)
+
+	flagSet, organizationId = newConfigFlagSet(true)
+	assert.NoError(t, flagSet.Parse([]string{"-organization-id", "from-command-line"}))
+	assert.NoError(t, configure(flagSet))
+	assert.Equal(t, "from-command-line", *organizationId)
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SmartBear/one-report-changeset-publisher"
+	"github.com/libgit2/git2go/v33"
+	"github.com/sabhiram/go-gitignore"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+type publishFlags struct {
+	organizationId    *string
+	url               *string
+	auth              *string
+	username          *string
+	password          *string
+	token             *string
+	apiKeyHeader      *string
+	tokenUrl          *string
+	clientId          *string
+	clientSecret      *string
+	scopes            stringList
+	credentialsFile   *string
+	passwordStdin     *bool
+	allowPasswordFlag *bool
+	retries           *int
+	retryBackoff      *time.Duration
+	maxRetryBackoff   *time.Duration
+	timeout           *time.Duration
+	proxy             *string
+	caFile            *string
+	certFile          *string
+	keyFile           *string
+	insecure          *bool
+	compression       *string
+	maxPartSize       *int
+	queueDir          *string
+	authenticator     publisher.Authenticator
+	options           *publisher.PublishOptions
+}
+
+func addPublishFlags(flagSet *flag.FlagSet) *publishFlags {
+	f := &publishFlags{
+		organizationId:    flagSet.String("organization-id", "", "OneReport organization id"),
+		url:               flagSet.String("url", "https://one-report.vercel.app", "OneReport url"),
+		auth:              flagSet.String("auth", "basic", "Authentication: basic (username and password), bearer (token), api-key (token in the -api-key-header header) or client-credentials (OAuth2)"),
+		username:          flagSet.String("username", "", "OneReport username"),
+		password:          flagSet.String("password", "", "OneReport password (prefer ONE_REPORT_PASSWORD, -credentials-file or -password-stdin)"),
+		token:             flagSet.String("token", "", "OneReport API token (prefer ONE_REPORT_TOKEN, -credentials-file or -password-stdin)"),
+		apiKeyHeader:      flagSet.String("api-key-header", publisher.DefaultAPIKeyHeader, "Header for the token, with -auth api-key"),
+		credentialsFile:   flagSet.String("credentials-file", "", "YAML file with the OneReport username and password, or token, only readable by its owner"),
+		passwordStdin:     flagSet.Bool("password-stdin", false, "Read the OneReport password, or token, from stdin"),
+		tokenUrl:          flagSet.String("token-url", "", "OAuth2 token endpoint, with -auth client-credentials"),
+		clientId:          flagSet.String("client-id", "", "OAuth2 client id, with -auth client-credentials"),
+		clientSecret:      flagSet.String("client-secret", "", "OAuth2 client secret (prefer ONE_REPORT_CLIENT_SECRET, -credentials-file or -password-stdin)"),
+		retries:           flagSet.Int("retries", 3, "Number of times to retry publishing after a network error, 408, 429 or 5xx response"),
+		retryBackoff:      flagSet.Duration("retry-backoff", time.Second, "Delay before the first retry, doubled for each further retry"),
+		maxRetryBackoff:   flagSet.Duration("max-retry-backoff", 30*time.Second, "Maximum delay between retries"),
+		timeout:           flagSet.Duration("timeout", time.Minute, "Time limit for OneReport to respond once a request has been sent (0 means no limit)"),
+		proxy:             flagSet.String("proxy", "", "Proxy url (default is the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables)"),
+		caFile:            flagSet.String("ca-file", "", "PEM file with CA certificates to trust, in addition to the system ones"),
+		certFile:          flagSet.String("cert-file", "", "PEM file with a client certificate, for mutual TLS"),
+		keyFile:           flagSet.String("key-file", "", "PEM file with the key of the client certificate"),
+		insecure:          flagSet.Bool("insecure-skip-verify", false, "Do not verify the OneReport server certificate (only for testing)"),
+		compression:       flagSet.String("compression", "none", "Compression of the published changesets: none, gzip or zstd"),
+		queueDir:          flagSet.String("queue-dir", "", "Directory where changesets that cannot be published are queued, to publish them later with the flush command"),
+		maxPartSize:       flagSet.Int("max-part-size", 0, "Publish changesets whose changes are larger than this many bytes in several parts (0 means no limit)"),
+		allowPasswordFlag: flagSet.Bool("allow-password-flag", false, "Allow -password, -token and -client-secret, which expose secrets in process listings"),
+	}
+	flagSet.Var(&f.scopes, "scope", "OAuth2 scope to request, with -auth client-credentials (repeatable)")
+	return f
+}
+
+// checkPasswordFlag refuses a -password, -token or -client-secret given on the command line, unless
+// -allow-password-flag is given too. It must be called before configure, which sets them from
+// ONE_REPORT_PASSWORD, ONE_REPORT_TOKEN and ONE_REPORT_CLIENT_SECRET.
+func (f *publishFlags) checkPasswordFlag(flagSet *flag.FlagSet) error {
+	var err error
+	flagSet.Visit(func(fl *flag.Flag) {
+		if (fl.Name == "password" || fl.Name == "token" || fl.Name == "client-secret") && !*f.allowPasswordFlag {
+			err = fmt.Errorf("-%s exposes secrets in process listings, use %s, -credentials-file or -password-stdin instead (or -allow-password-flag)", fl.Name, envName(fl.Name))
+		}
+	})
+	return err
+}
+
+// readCredentials reads the credentials from stdin with -password-stdin, from -username, -password,
+// -token and -client-secret (or their ONE_REPORT_* environment variables), and from -credentials-file,
+// in that order of precedence.
+func (f *publishFlags) readCredentials() (*publisher.Credentials, error) {
+	credentials := &publisher.Credentials{}
+	if *f.credentialsFile != "" {
+		fileCredentials, err := publisher.ReadCredentialsFile(*f.credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		credentials = fileCredentials
+	}
+	if *f.username != "" {
+		credentials.Username = *f.username
+	}
+	if *f.password != "" {
+		credentials.Password = *f.password
+	}
+	if *f.token != "" {
+		credentials.Token = *f.token
+	}
+	if *f.clientSecret != "" {
+		credentials.ClientSecret = *f.clientSecret
+	}
+	if *f.passwordStdin {
+		secret, err := publisher.ReadPassword(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		switch *f.auth {
+		case "basic":
+			credentials.Password = secret
+		case "client-credentials":
+			credentials.ClientSecret = secret
+		default:
+			credentials.Token = secret
+		}
+	}
+	return credentials, nil
+}
+
+// newAuthenticator returns the Authenticator selected by -auth.
+func (f *publishFlags) newAuthenticator(client *http.Client) (publisher.Authenticator, error) {
+	credentials, err := f.readCredentials()
+	if err != nil {
+		return nil, err
+	}
+	switch *f.auth {
+	case "basic":
+		return &publisher.BasicAuth{Username: credentials.Username, Password: credentials.Password}, nil
+	case "bearer":
+		return &publisher.BearerToken{Token: credentials.Token}, nil
+	case "api-key":
+		return &publisher.APIKey{Header: *f.apiKeyHeader, Key: credentials.Token}, nil
+	case "client-credentials":
+		if *f.tokenUrl == "" {
+			return nil, errors.New("-auth client-credentials requires -token-url")
+		}
+		return &publisher.ClientCredentials{
+			TokenURL:     *f.tokenUrl,
+			ClientID:     *f.clientId,
+			ClientSecret: credentials.ClientSecret,
+			Scopes:       f.scopes,
+			Client:       client,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown -auth %q, expected basic, bearer, api-key or client-credentials", *f.auth)
+	}
+}
+
+// newPublishOptions returns the retry, HTTP client and compression settings.
+func (f *publishFlags) newPublishOptions() (*publisher.PublishOptions, error) {
+	compression, err := publisher.ParseCompression(*f.compression)
+	if err != nil {
+		return nil, err
+	}
+	client, err := publisher.NewHTTPClient(publisher.HTTPClientConfig{
+		Timeout:            *f.timeout,
+		ProxyURL:           *f.proxy,
+		CAFile:             *f.caFile,
+		CertFile:           *f.certFile,
+		KeyFile:            *f.keyFile,
+		InsecureSkipVerify: *f.insecure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var queue *publisher.Queue
+	if *f.queueDir != "" {
+		queue = publisher.NewQueue(*f.queueDir)
+	}
+	return &publisher.PublishOptions{
+		Client:         client,
+		Retries:        *f.retries,
+		InitialBackoff: *f.retryBackoff,
+		MaxBackoff:     *f.maxRetryBackoff,
+		Compression:    compression,
+		MaxPartSize:    *f.maxPartSize,
+		Queue:          queue,
+	}, nil
+}
+
+// canStream returns whether changesets can be streamed while they are computed. Changesets that
+// may be split into parts must be computed first.
+func (f *publishFlags) canStream() bool {
+	return *f.maxPartSize <= 0
+}
+
+// prepare makes the publish options and the authenticator, once, so that stdin is only read once,
+// and OAuth2 access tokens are reused across changesets.
+func (f *publishFlags) prepare() error {
+	if f.options != nil {
+		return nil
+	}
+	options, err := f.newPublishOptions()
+	if err != nil {
+		return err
+	}
+	authenticator, err := f.newAuthenticator(options.Client)
+	if err != nil {
+		return err
+	}
+	f.options = options
+	f.authenticator = authenticator
+	return nil
+}
+
+// publish publishes a changeset. With -queue-dir, a changeset that cannot be published because
+// OneReport is unreachable or unavailable is queued instead, without failing, and the reason is
+// printed to stderr. It returns whether the changeset was queued rather than published.
+func (f *publishFlags) publish(metaChangeset publisher.ChangesetEncoder) (string, bool, error) {
+	err := f.prepare()
+	if err != nil {
+		return "", false, err
+	}
+	txt, err := publisher.Publish(metaChangeset, *f.organizationId, *f.url, f.authenticator, f.options)
+	if errors.Is(err, publisher.ErrQueued) {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		return "Changeset queued, publish it later with the flush command", true, nil
+	}
+	return txt, false, err
+}
+
+// flush publishes the changesets queued in -queue-dir, and returns how many it published.
+func (f *publishFlags) flush() (int, error) {
+	if *f.queueDir == "" {
+		return 0, errors.New("please specify -queue-dir")
+	}
+	err := f.prepare()
+	if err != nil {
+		return 0, err
+	}
+	return publisher.NewQueue(*f.queueDir).Flush(*f.organizationId, *f.url, f.authenticator, f.options)
+}
+
+type optionsFlags struct {
+	concurrency   *int
+	noCache       *bool
+	clearCache    *bool
+	cacheMaxAge   *time.Duration
+	excludeBinary *bool
+	maxBlobSize   *int64
+	languages     *bool
+	languageMap   languageMap
+	logicalLoc    *bool
+	include       stringList
+	exclude       stringList
+	contextSize   *int
+	identical     *bool
+	*pathFlags
+}
+
+func addOptionsFlags(flagSet *flag.FlagSet) *optionsFlags {
+	f := &optionsFlags{
+		concurrency:   flagSet.Int("concurrency", runtime.NumCPU(), "Maximum number of files to compute line mappings for in parallel"),
+		noCache:       flagSet.Bool("no-cache", false, "Do not cache line mappings and file counts in .git/one-report"),
+		clearCache:    flagSet.Bool("clear-cache", false, "Clear the caches in .git/one-report before running"),
+		cacheMaxAge:   flagSet.Duration("cache-max-age", 30*24*time.Hour, "Remove cache entries that were not used for this long (0 means never)"),
+		excludeBinary: flagSet.Bool("exclude-binary", false, "Leave binary files out of the changeset and file count"),
+		maxBlobSize:   flagSet.Int64("max-blob-size", 0, "Files larger than this many bytes are marked oversized instead of being diffed and line counted (0 means no limit)"),
+		languages:     flagSet.Bool("languages", false, "Count lines of code and files per language"),
+		languageMap:   languageMap{},
+		logicalLoc:    flagSet.Bool("logical-loc", false, "Also count code, comment and blank lines"),
+		contextSize:   flagSet.Int("lhdiff-context-size", 4, "Number of lines of context lhdiff uses to match lines"),
+		identical:     flagSet.Bool("lhdiff-include-identical-lines", false, "Also map lines that are unchanged"),
+		pathFlags:     addPathFlags(flagSet),
+	}
+	flagSet.Var(f.languageMap, "language", "Map a file extension or name to a language, e.g. .tsx=TypeScript (repeatable)")
+	flagSet.Var(&f.include, "include", "Pattern of files to include, in addition to .onereportinclude (repeatable)")
+	flagSet.Var(&f.exclude, "exclude", "Pattern of files to exclude, in addition to .onereportignore (repeatable)")
+	return f
+}
+
+// options returns the options, and the exclude and include patterns.
+func (f *optionsFlags) options(repo *git.Repository) (*publisher.Options, *ignore.GitIgnore, *ignore.GitIgnore, error) {
+	options := &publisher.Options{
+		Concurrency:                 *f.concurrency,
+		ExcludeBinary:               *f.excludeBinary,
+		MaxBlobSize:                 *f.maxBlobSize,
+		CountLanguages:              *f.languages,
+		Languages:                   f.languageMap,
+		CountLogicalLines:           *f.logicalLoc,
+		LhdiffContextSize:           *f.contextSize,
+		LhdiffIncludeIdenticalLines: *f.identical,
+	}
+	err := f.pathFlags.apply(options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	excludeLines, err := patternLines(repo, ".onereportignore", f.exclude)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	includeLines, err := patternLines(repo, ".onereportinclude", f.include)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cacheDir := filepath.Join(repo.Path(), "one-report")
+	if *f.clearCache {
+		err = publisher.NewLineMappingsCache(filepath.Join(cacheDir, "line-mappings")).Clear()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = publisher.NewFeaturesCache(filepath.Join(cacheDir, "features")).Clear()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if !*f.noCache && *f.cacheMaxAge > 0 {
+		err = publisher.NewLineMappingsCache(filepath.Join(cacheDir, "line-mappings")).Prune(*f.cacheMaxAge)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = publisher.NewFeaturesCache(filepath.Join(cacheDir, "features")).Prune(*f.cacheMaxAge)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if !*f.noCache {
+		fingerprint := patternsFingerprint(excludeLines, includeLines)
+		options.Cache = publisher.NewLineMappingsCache(filepath.Join(cacheDir, "line-mappings"))
+		options.FeaturesCache = publisher.NewFeaturesCache(filepath.Join(cacheDir, "features", fingerprint))
+	}
+	return options, compilePatterns(excludeLines), compilePatterns(includeLines), nil
+}
+
+type pathFlags struct {
+	keyFile     *string
+	segments    *bool
+	clearLevels *int
+}
+
+func addPathFlags(flagSet *flag.FlagSet) *pathFlags {
+	return &pathFlags{
+		keyFile:     flagSet.String("path-key-file", "", "File with a secret key for anonymising paths (default is the ONE_REPORT_PATH_KEY environment variable)"),
+		segments:    flagSet.Bool("hash-path-segments", false, "Hash each path segment on its own, preserving the directory structure"),
+		clearLevels: flagSet.Int("clear-path-levels", 0, "Number of top directory levels to keep in clear when hashing paths"),
+	}
+}
+
+func (f *pathFlags) apply(options *publisher.Options) error {
+	pathKey, err := readPathKey(*f.keyFile)
+	if err != nil {
+		return err
+	}
+	options.PathKey = pathKey
+	options.HashPathSegments = *f.segments
+	options.ClearPathLevels = *f.clearLevels
+	return nil
+}
+
+// readPathKey reads the key for anonymising paths from pathKeyFile, or from the ONE_REPORT_PATH_KEY
+// environment variable. It returns nil (plain SHA-1 hashing) if neither is set.
+func readPathKey(pathKeyFile string) ([]byte, error) {
+	if pathKeyFile == "" {
+		if key := os.Getenv("ONE_REPORT_PATH_KEY"); key != "" {
+			return []byte(key), nil
+		}
+		return nil, nil
+	}
+	contents, err := os.ReadFile(pathKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(contents)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("path key file %s is empty", pathKeyFile)
+	}
+	return key, nil
+}
+
+// patternLines returns the patterns in the named file in the working directory, followed by extra.
+func patternLines(repo *git.Repository, name string, extra []string) ([]string, error) {
+	var lines []string
+	contents, err := os.ReadFile(filepath.Join(repo.Workdir(), name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		lines = strings.Split(string(contents), "\n")
+	}
+	return append(lines, extra...), nil
+}
+
+// compilePatterns returns nil when there are no patterns, so that nothing is filtered.
+func compilePatterns(lines []string) *ignore.GitIgnore {
+	if len(lines) == 0 {
+		return nil
+	}
+	return ignore.CompileIgnoreLines(lines...)
+}
+
+// patternsFingerprint identifies the exclude and include patterns, which file counts depend on.
+func patternsFingerprint(excludeLines []string, includeLines []string) string {
+	h := sha1.New()
+	h.Write([]byte(strings.Join(excludeLines, "\n")))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(includeLines, "\n")))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// stringList is a flag.Value collecting repeated values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// languageMap is a flag.Value collecting extension=Language pairs.
+type languageMap map[string]string
+
+func (m languageMap) String() string {
+	var pairs []string
+	for key, language := range m {
+		pairs = append(pairs, key+"="+language)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m languageMap) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected extension=Language, got %q", value)
+	}
+	m[parts[0]] = parts[1]
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func doFlush(args []string) error {
+	flagSet := flag.NewFlagSet("flush", flag.ExitOnError)
+	flags := addPublishFlags(flagSet)
+	addConfigFlag(flagSet)
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = flags.checkPasswordFlag(flagSet)
+	if err != nil {
+		return err
+	}
+	err = configure(flagSet)
+	if err != nil {
+		return err
+	}
+
+	n, err := flags.flush()
+	fmt.Printf("Published %d queued changesets\n", n)
+	return err
+}
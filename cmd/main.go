@@ -10,7 +10,25 @@ import (
 )
 
 func main() {
-	err := doMain()
+	var err error
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "backfill":
+		err = doBackfill(os.Args[2:])
+	case "resolve":
+		err = doResolve(os.Args[2:])
+	case "flush":
+		err = doFlush(os.Args[2:])
+	case "publish-file":
+		err = doPublishFile(os.Args[2:])
+	case "validate":
+		err = doValidate(os.Args[2:])
+	default:
+		err = doMain()
+	}
 	if err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -18,40 +36,80 @@ func main() {
 }
 
 func doMain() error {
-	organizationId := flag.String("organization-id", "", "OneReport organization id")
+	flags := addPublishFlags(flag.CommandLine)
+	optionsFlags := addOptionsFlags(flag.CommandLine)
 	remote := flag.String("remote", "", "Git remote (default is the origin remote in .git/config)")
 	oldSha := flag.String("old-sha", "", "Old revision (default is all the the parents of sha)")
 	sha := flag.String("sha", "", "revision (default is the HEAD revision)")
-	username := flag.String("username", "", "OneReport username")
-	password := flag.String("password", "", "OneReport password")
+	revisionRange := flag.String("range", "", "Revision range (A..B). Makes one changeset per commit, ignoring -old-sha and -sha")
 	publish := flag.Bool("publish", false, "Publish the changeset")
 	usePaths := flag.Bool("use-paths", false, "Use file paths instead of hashed paths")
-	url := flag.String("url", "https://one-report.vercel.app", "OneReport url")
+	dir := addDirFlag(flag.CommandLine)
+	addConfigFlag(flag.CommandLine)
 	flag.Parse()
-
-	repo, err := git.OpenRepository(".")
+	err := flags.checkPasswordFlag(flag.CommandLine)
+	if err != nil {
+		return err
+	}
+	err = configure(flag.CommandLine)
 	if err != nil {
 		return err
 	}
 
-	metaChangeset, err := publisher.MakeMetaChangeset(*oldSha, *sha, *usePaths, *remote, repo, nil, nil, true)
+	repo, err := git.OpenRepository(*dir)
 	if err != nil {
 		return err
 	}
-	if *publish {
-		txt, err := publisher.Publish(metaChangeset, *organizationId, *url, *username, *password)
+	options, exclude, include, err := optionsFlags.options(repo)
+	if err != nil {
+		return err
+	}
+
+	handle := func(metaChangeset *publisher.MetaChangeset) error {
+		if *publish {
+			txt, _, err := flags.publish(metaChangeset)
+			if err != nil {
+				return err
+			}
+			fmt.Println(txt)
+		} else if *revisionRange != "" {
+			// One changeset per line, which publish-file and validate read back
+			bytes, err := json.Marshal(metaChangeset)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(bytes))
+		} else {
+			bytes, err := json.MarshalIndent(metaChangeset, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(bytes))
+		}
+		return nil
+	}
+
+	if *revisionRange != "" {
+		return publisher.MakeMetaChangesets(*revisionRange, *usePaths, *remote, repo, exclude, include, true, options, handle)
+	}
+
+	if *publish && flags.canStream() {
+		// Stream the changes to OneReport as they are computed, rather than holding them all in memory
+		stream, err := publisher.NewMetaChangesetStream(*oldSha, *sha, *usePaths, *remote, repo, exclude, include, true, options)
 		if err != nil {
 			return err
 		}
-		fmt.Println(txt)
-	} else {
-		bytes, err := json.MarshalIndent(metaChangeset, "", "  ")
+		txt, _, err := flags.publish(stream)
 		if err != nil {
 			return err
 		}
-		fmt.Println(string(bytes))
+		fmt.Println(txt)
+		return nil
 	}
-	return nil
-}
-
 
+	metaChangeset, err := publisher.MakeMetaChangeset(*oldSha, *sha, *usePaths, *remote, repo, exclude, include, true, options)
+	if err != nil {
+		return err
+	}
+	return handle(metaChangeset)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SmartBear/one-report-changeset-publisher"
+	"os"
+)
+
+func doPublishFile(args []string) error {
+	flagSet := flag.NewFlagSet("publish-file", flag.ExitOnError)
+	flags := addPublishFlags(flagSet)
+	addConfigFlag(flagSet)
+	flagSet.Usage = func() {
+		_, _ = fmt.Fprintf(flagSet.Output(), "Usage: %s publish-file [flags] file...\n\nPublishes changesets printed by %s, one or more per file (use - for stdin).\n\n", os.Args[0], os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = flags.checkPasswordFlag(flagSet)
+	if err != nil {
+		return err
+	}
+	err = configure(flagSet)
+	if err != nil {
+		return err
+	}
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		return errors.New("please specify the files to publish")
+	}
+
+	// Read all the files first, so that none is published if one is invalid
+	var changesets []*publisher.MetaChangeset
+	for _, file := range flagSet.Args() {
+		var fileChangesets []*publisher.MetaChangeset
+		if file == "-" {
+			if *flags.passwordStdin {
+				return errors.New("cannot read both a changeset and -password-stdin from stdin")
+			}
+			fileChangesets, err = publisher.ReadMetaChangesets(os.Stdin)
+			if err != nil {
+				err = fmt.Errorf("stdin: %w", err)
+			}
+		} else {
+			fileChangesets, err = publisher.ReadMetaChangesetsFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		changesets = append(changesets, fileChangesets...)
+	}
+
+	for _, changeset := range changesets {
+		txt, _, err := flags.publish(changeset)
+		if err != nil {
+			return err
+		}
+		fmt.Println(txt)
+	}
+	return nil
+}
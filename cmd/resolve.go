@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/SmartBear/one-report-changeset-publisher"
+	"github.com/libgit2/git2go/v33"
+	"os"
+)
+
+func doResolve(args []string) error {
+	flagSet := flag.NewFlagSet("resolve", flag.ExitOnError)
+	pathFlags := addPathFlags(flagSet)
+	sha := flagSet.String("sha", "", "Revision whose paths to resolve (default is the HEAD revision)")
+	in := flagSet.String("in", "", "File (e.g. a OneReport export) to print with hashed paths replaced by paths")
+	dir := addDirFlag(flagSet)
+	addConfigFlag(flagSet)
+	flagSet.Usage = func() {
+		_, _ = fmt.Fprintf(flagSet.Output(), "Usage: %s resolve [flags] [hash...]\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = configure(flagSet)
+	if err != nil {
+		return err
+	}
+
+	options := &publisher.Options{}
+	err = pathFlags.apply(options)
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.OpenRepository(*dir)
+	if err != nil {
+		return err
+	}
+	revision := *sha
+	if revision == "" {
+		revision = "HEAD"
+	}
+	obj, err := repo.RevparseSingle(revision)
+	if err != nil {
+		return err
+	}
+	treeObj, err := obj.Peel(git.ObjectTree)
+	if err != nil {
+		return err
+	}
+	tree, err := treeObj.AsTree()
+	if err != nil {
+		return err
+	}
+	hashes, err := publisher.PathHashes(tree, options)
+	if err != nil {
+		return err
+	}
+
+	if *in != "" {
+		contents, err := os.ReadFile(*in)
+		if err != nil {
+			return err
+		}
+		fmt.Print(publisher.ResolvePathHashes(string(contents), hashes))
+		return nil
+	}
+	for _, hash := range flagSet.Args() {
+		path, ok := hashes[hash]
+		if !ok {
+			path = "?"
+		}
+		fmt.Printf("%s %s\n", hash, path)
+	}
+	return nil
+}
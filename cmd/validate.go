@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/SmartBear/one-report-changeset-publisher"
+	"os"
+)
+
+func doValidate(args []string) error {
+	flagSet := flag.NewFlagSet("validate", flag.ExitOnError)
+	printSchema := flagSet.Bool("schema", false, "Print the JSON Schema of changesets")
+	flagSet.Usage = func() {
+		_, _ = fmt.Fprintf(flagSet.Output(), "Usage: %s validate [flags] file...\n\nValidates changesets printed by %s, one or more per file (use - for stdin).\n\n", os.Args[0], os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *printSchema {
+		_, err = os.Stdout.Write(publisher.ChangesetSchema)
+		return err
+	}
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		return errors.New("please specify the files to validate")
+	}
+
+	invalid := 0
+	for _, file := range flagSet.Args() {
+		if file == "-" {
+			_, err = publisher.ReadMetaChangesets(os.Stdin)
+			if err != nil {
+				err = fmt.Errorf("stdin: %w", err)
+			}
+		} else {
+			_, err = publisher.ReadMetaChangesetsFile(file)
+		}
+		if err != nil {
+			invalid++
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			continue
+		}
+		fmt.Printf("%s: valid\n", file)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d files are invalid", invalid, flagSet.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package publisher
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublishWithGzipCompression(t *testing.T) {
+	changeset := &MetaChangeset{Remote: "some-remote", Sha: "bbb", Changes: make([]Change, 0), Loc: 9876}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+		r, err := gzip.NewReader(req.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		received := &MetaChangeset{}
+		assert.NoError(t, json.NewDecoder(r).Decode(received))
+		assert.Equal(t, changeset, received)
+		_, _ = res.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	txt, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Compression: GzipCompression})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+}
+
+func TestPublishWithZstdCompression(t *testing.T) {
+	changeset := &MetaChangeset{Remote: "some-remote", Sha: "bbb", Changes: make([]Change, 0), Loc: 9876}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "zstd", req.Header.Get("Content-Encoding"))
+		r, err := zstd.NewReader(req.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer r.Close()
+		received := &MetaChangeset{}
+		assert.NoError(t, json.NewDecoder(r).Decode(received))
+		assert.Equal(t, changeset, received)
+		_, _ = res.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	txt, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Compression: ZstdCompression})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+}
+
+func TestMakeRequestWithoutCompression(t *testing.T) {
+	req, err := MakeRequest(&MetaChangeset{Sha: "bbb"}, "org", "https://host.com", nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, req.Header.Get("Content-Encoding"))
+	body, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"sha":"bbb"`)
+}
+
+func TestParseCompression(t *testing.T) {
+	compression, err := ParseCompression("gzip")
+	assert.NoError(t, err)
+	assert.Equal(t, GzipCompression, compression)
+
+	compression, err = ParseCompression("zstd")
+	assert.NoError(t, err)
+	assert.Equal(t, ZstdCompression, compression)
+
+	compression, err = ParseCompression("none")
+	assert.NoError(t, err)
+	assert.Equal(t, NoCompression, compression)
+
+	_, err = ParseCompression("brotli")
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package publisher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config holds the settings in a .onereport.yml file. Each key has the same name as the
+// corresponding command line flag. Settings that are not in the file are nil.
+type Config struct {
+	OrganizationId              *string           `yaml:"organization-id"`
+	Url                         *string           `yaml:"url"`
+	Auth                        *string           `yaml:"auth"`
+	Username                    *string           `yaml:"username"`
+	APIKeyHeader                *string           `yaml:"api-key-header"`
+	TokenUrl                    *string           `yaml:"token-url"`
+	ClientId                    *string           `yaml:"client-id"`
+	Scope                       []string          `yaml:"scope"`
+	Retries                     *int              `yaml:"retries"`
+	RetryBackoff                *time.Duration    `yaml:"retry-backoff"`
+	MaxRetryBackoff             *time.Duration    `yaml:"max-retry-backoff"`
+	Timeout                     *time.Duration    `yaml:"timeout"`
+	Proxy                       *string           `yaml:"proxy"`
+	CAFile                      *string           `yaml:"ca-file"`
+	CertFile                    *string           `yaml:"cert-file"`
+	KeyFile                     *string           `yaml:"key-file"`
+	InsecureSkipVerify          *bool             `yaml:"insecure-skip-verify"`
+	Compression                 *string           `yaml:"compression"`
+	MaxPartSize                 *int              `yaml:"max-part-size"`
+	QueueDir                    *string           `yaml:"queue-dir"`
+	CredentialsFile             *string           `yaml:"credentials-file"`
+	Remote                      *string           `yaml:"remote"`
+	UsePaths                    *bool             `yaml:"use-paths"`
+	PathKeyFile                 *string           `yaml:"path-key-file"`
+	HashPathSegments            *bool             `yaml:"hash-path-segments"`
+	ClearPathLevels             *int              `yaml:"clear-path-levels"`
+	Include                     []string          `yaml:"include"`
+	Exclude                     []string          `yaml:"exclude"`
+	Concurrency                 *int              `yaml:"concurrency"`
+	NoCache                     *bool             `yaml:"no-cache"`
+	CacheMaxAge                 *time.Duration    `yaml:"cache-max-age"`
+	ExcludeBinary               *bool             `yaml:"exclude-binary"`
+	MaxBlobSize                 *int64            `yaml:"max-blob-size"`
+	Languages                   *bool             `yaml:"languages"`
+	Language                    map[string]string `yaml:"language"`
+	LogicalLoc                  *bool             `yaml:"logical-loc"`
+	LhdiffContextSize           *int              `yaml:"lhdiff-context-size"`
+	LhdiffIncludeIdenticalLines *bool             `yaml:"lhdiff-include-identical-lines"`
+}
+
+// LoadConfig reads a config file. A missing file is not an error, and results in an empty Config.
+// Unknown keys are reported as errors, so misspelt settings are not silently ignored.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Values returns the settings in the config as command line flag values, keyed by flag name.
+// Lists have one value per element, and maps one key=value per entry.
+func (c *Config) Values() map[string][]string {
+	values := make(map[string][]string)
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Ptr:
+			if !field.IsNil() {
+				values[name] = []string{fmt.Sprint(field.Elem().Interface())}
+			}
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				values[name] = append(values[name], field.Index(j).String())
+			}
+		case reflect.Map:
+			var pairs []string
+			iter := field.MapRange()
+			for iter.Next() {
+				pairs = append(pairs, iter.Key().String()+"="+iter.Value().String())
+			}
+			sort.Strings(pairs)
+			if len(pairs) > 0 {
+				values[name] = pairs
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,67 @@
+package publisher
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".onereport.yml")
+	err := os.WriteFile(path, []byte(`
+organization-id: 1CCC7924-051C-496E-8467-D494C1C37B2A
+url: https://onereport.example.com
+hash-path-segments: true
+clear-path-levels: 2
+include:
+  - "**/*.go"
+  - "testdata/*"
+max-blob-size: 1048576
+language:
+  .tpl: HTML
+  .tsx: TypeScript
+lhdiff-context-size: 3
+retry-backoff: 2s
+`), 0644)
+	assert.NoError(t, err)
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"organization-id":     {"1CCC7924-051C-496E-8467-D494C1C37B2A"},
+		"url":                 {"https://onereport.example.com"},
+		"hash-path-segments":  {"true"},
+		"clear-path-levels":   {"2"},
+		"include":             {"**/*.go", "testdata/*"},
+		"max-blob-size":       {"1048576"},
+		"language":            {".tpl=HTML", ".tsx=TypeScript"},
+		"lhdiff-context-size": {"3"},
+		"retry-backoff":       {"2s"},
+	}, config.Values())
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	config, err := LoadConfig(filepath.Join(t.TempDir(), ".onereport.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{}, config.Values())
+}
+
+func TestLoadEmptyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".onereport.yml")
+	err := os.WriteFile(path, []byte("# nothing yet\n"), 0644)
+	assert.NoError(t, err)
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{}, config.Values())
+}
+
+func TestLoadConfigWithUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".onereport.yml")
+	err := os.WriteFile(path, []byte("organisation-id: oops\n"), 0644)
+	assert.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
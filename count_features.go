@@ -1,39 +1,250 @@
 package publisher
 
 import (
+	"crypto/sha1"
+	"fmt"
 	"github.com/libgit2/git2go/v33"
 	"github.com/sabhiram/go-gitignore"
 	"strings"
+	"time"
 )
 
+// Features holds the size of a tree.
+type Features struct {
+	// The total number of lines of code, or -1 if lines were not counted
+	Loc int `json:"loc"`
+	// The total number of files
+	Files int `json:"files"`
+	// The number of files that are larger than Options.MaxBlobSize, and not counted in Loc
+	OversizedFiles int `json:"oversizedFiles"`
+	// The number of code, comment and blank lines in Loc, with Options.CountLogicalLines
+	CodeLoc    int `json:"codeLoc"`
+	CommentLoc int `json:"commentLoc"`
+	BlankLoc   int `json:"blankLoc"`
+	// The features of each language, with Options.CountLanguages
+	Languages map[string]LanguageFeatures `json:"languages,omitempty"`
+}
+
 // CountFeatures counts how many lines of code, and how many files there are.
-func CountFeatures(repo *git.Repository, tree *git.Tree, exclude *ignore.GitIgnore, include *ignore.GitIgnore, countLines bool) (int, int, error) {
-	var loc int
-	if countLines {
-		loc = 0
-	} else {
-		loc = -1
+func CountFeatures(repo *git.Repository, tree *git.Tree, exclude *ignore.GitIgnore, include *ignore.GitIgnore, countLines bool, options *Options) (*Features, error) {
+	features := newFeatures(countLines)
+	odb, err := repo.Odb()
+	if err != nil {
+		return nil, err
 	}
-	files := 0
+	defer odb.Free()
 
-	err := tree.Walk(func(name string, entry *git.TreeEntry) error {
+	err = tree.Walk(func(name string, entry *git.TreeEntry) error {
 		isFile := entry.Filemode&git.FilemodeBlob != 0
 		path := strings.Join([]string{name, entry.Name}, "")
 		if isFile && fileIncluded(exclude, include, path) {
-			files += 1
-			if countLines {
-				blob, err := repo.LookupBlob(entry.Id)
-				if err != nil {
-					return err
-				}
-				contents := string(blob.Contents())
-				loc += lineCount(contents)
-			}
+			return features.addFile(repo, odb, path, entry.Id, 1, countLines, options)
 		}
 		return nil
 	})
 
-	return loc, files, err
+	return features, err
+}
+
+// CountFeaturesIncrementally counts the features of a tree from parentFeatures, the features of
+// the parent tree, by only counting the files that differ between the two trees. diff must be the
+// diff from the parent tree to the tree, and may have been through Diff.FindSimilar.
+func CountFeaturesIncrementally(repo *git.Repository, parentFeatures *Features, diff *git.Diff, exclude *ignore.GitIgnore, include *ignore.GitIgnore, countLines bool, options *Options) (*Features, error) {
+	features := parentFeatures.copy()
+	odb, err := repo.Odb()
+	if err != nil {
+		return nil, err
+	}
+	defer odb.Free()
+
+	err = diff.ForEach(func(file git.DiffDelta, progress float64) (git.DiffForEachHunkCallback, error) {
+		// The source of a copy is still in the tree, and is counted by its own delta if it changed
+		if file.Status != git.DeltaCopied && diffFileCounted(file.OldFile, exclude, include) {
+			err := features.addFile(repo, odb, file.OldFile.Path, file.OldFile.Oid, -1, countLines, options)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if diffFileCounted(file.NewFile, exclude, include) {
+			err := features.addFile(repo, odb, file.NewFile.Path, file.NewFile.Oid, 1, countLines, options)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}, git.DiffDetailFiles)
+
+	return features, err
+}
+
+// FeaturesCache stores the features of trees on disk, so they can be counted incrementally from
+// the features of their parent. Features depend on the include and exclude patterns, so each set of
+// patterns needs its own cache directory.
+type FeaturesCache struct {
+	diskCache
+}
+
+// NewFeaturesCache returns a cache that stores features in dir.
+func NewFeaturesCache(dir string) *FeaturesCache {
+	return &FeaturesCache{diskCache{dir: dir}}
+}
+
+// Clear removes all cached features.
+func (c *FeaturesCache) Clear() error {
+	return c.clear()
+}
+
+// Prune removes the cached features that were not used in the last maxAge.
+func (c *FeaturesCache) Prune(maxAge time.Duration) error {
+	return c.prune(maxAge)
+}
+
+func (c *FeaturesCache) getFeatures(treeOid *git.Oid, countLines bool, options *Options) (*Features, bool) {
+	features := &Features{}
+	ok := c.get(featuresCacheKey(treeOid, countLines, options), features)
+	return features, ok
+}
+
+func (c *FeaturesCache) putFeatures(treeOid *git.Oid, countLines bool, options *Options, features *Features) error {
+	return c.put(featuresCacheKey(treeOid, countLines, options), features)
+}
+
+// featuresCacheKey identifies the features of a tree, counted with the given settings.
+func featuresCacheKey(treeOid *git.Oid, countLines bool, options *Options) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "%s:%t:%t:%d:%s:%t", treeOid.String(), countLines, options.excludeBinary(), options.maxBlobSize(), options.languagesKey(), options.countLogicalLines())
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// countFeatures counts the features of tree, incrementally from the cached features of parentTree
+// when possible. Without a cache, or when parentTree's features are not cached, it walks the whole tree.
+func countFeatures(repo *git.Repository, tree *git.Tree, parentTree *git.Tree, diff *git.Diff, exclude *ignore.GitIgnore, include *ignore.GitIgnore, countLines bool, options *Options) (*Features, error) {
+	cache := options.featuresCache()
+	if cache == nil {
+		return CountFeatures(repo, tree, exclude, include, countLines, options)
+	}
+	if features, ok := cache.getFeatures(tree.Id(), countLines, options); ok {
+		return features, nil
+	}
+
+	var features *Features
+	var err error
+	if parentFeatures, ok := parentFeatures(cache, parentTree, countLines, options); ok {
+		features, err = CountFeaturesIncrementally(repo, parentFeatures, diff, exclude, include, countLines, options)
+	} else {
+		features, err = CountFeatures(repo, tree, exclude, include, countLines, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = cache.putFeatures(tree.Id(), countLines, options, features)
+	if err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+func parentFeatures(cache *FeaturesCache, parentTree *git.Tree, countLines bool, options *Options) (*Features, bool) {
+	if parentTree == nil {
+		return nil, false
+	}
+	return cache.getFeatures(parentTree.Id(), countLines, options)
+}
+
+func newFeatures(countLines bool) *Features {
+	features := &Features{}
+	if !countLines {
+		features.Loc = -1
+	}
+	return features
+}
+
+func (f *Features) copy() *Features {
+	features := *f
+	if f.Languages != nil {
+		features.Languages = make(map[string]LanguageFeatures, len(f.Languages))
+		for language, languageFeatures := range f.Languages {
+			features.Languages[language] = languageFeatures
+		}
+	}
+	return &features
+}
+
+// addFile adds (sign 1) or removes (sign -1) the blob's contribution to the features.
+func (f *Features) addFile(repo *git.Repository, odb *git.Odb, path string, oid *git.Oid, sign int, countLines bool, options *Options) error {
+	file, err := countFile(repo, odb, path, oid, countLines, options)
+	if err != nil || !file.counted {
+		return err
+	}
+	f.Files += sign
+	if file.oversized {
+		f.OversizedFiles += sign
+	}
+	if countLines {
+		f.Loc += sign * file.loc
+		f.CodeLoc += sign * file.logicalLines.code
+		f.CommentLoc += sign * file.logicalLines.comment
+		f.BlankLoc += sign * file.logicalLines.blank
+	}
+	if options.countLanguages() {
+		f.addLanguage(options.language(path), sign, file, countLines)
+	}
+	return nil
+}
+
+// fileFeatures holds the contribution of a single file to Features.
+type fileFeatures struct {
+	counted      bool
+	oversized    bool
+	loc          int
+	logicalLines logicalLines
+}
+
+// countFile counts the lines in a blob. Binary files have no lines, and are not counted at all
+// with Options.ExcludeBinary. Oversized files are not loaded, and have no lines either; only their
+// start is sniffed to leave out binary ones.
+func countFile(repo *git.Repository, odb *git.Odb, path string, oid *git.Oid, countLines bool, options *Options) (fileFeatures, error) {
+	oversized, err := blobIsOversized(odb, oid, options.maxBlobSize())
+	if err != nil {
+		return fileFeatures{}, err
+	}
+	if oversized {
+		if options.excludeBinary() {
+			binary, err := blobStartIsBinary(repo, odb, oid)
+			if err != nil || binary {
+				return fileFeatures{}, err
+			}
+		}
+		return fileFeatures{counted: true, oversized: true}, nil
+	}
+	if !countLines && !options.excludeBinary() {
+		return fileFeatures{counted: true}, nil
+	}
+	blob, err := repo.LookupBlob(oid)
+	if err != nil {
+		return fileFeatures{}, err
+	}
+	binary := blob.IsBinary()
+	if binary && options.excludeBinary() {
+		return fileFeatures{}, nil
+	}
+	file := fileFeatures{counted: true}
+	if countLines && !binary {
+		contents := string(blob.Contents())
+		file.loc = lineCount(contents)
+		if options.countLogicalLines() {
+			file.logicalLines = countLogicalLines(contents, options.commentSyntax(path))
+		}
+	}
+	return file, nil
+}
+
+// diffFileCounted returns whether CountFeatures counts the file on one side of a diff.
+func diffFileCounted(file git.DiffFile, exclude *ignore.GitIgnore, include *ignore.GitIgnore) bool {
+	exists := file.Flags&git.DiffFlagExists != 0
+	isFile := git.Filemode(file.Mode)&git.FilemodeBlob != 0
+	return exists && isFile && fileIncluded(exclude, include, file.Path)
 }
 
 // https://stackoverflow.com/questions/47240127/fastest-way-to-find-number-of-lines-in-go
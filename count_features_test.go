@@ -2,6 +2,7 @@ package publisher
 
 import (
 	"github.com/libgit2/git2go/v33"
+	"github.com/sabhiram/go-gitignore"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -16,10 +17,10 @@ func TestCountFeaturesWithLines(t *testing.T) {
 	assert.NoError(t, err)
 	tree, err := commit.Tree()
 	assert.NoError(t, err)
-	loc, files, err := CountFeatures(repo, tree, nil, nil, true)
+	features, err := CountFeatures(repo, tree, nil, nil, true, nil)
 	assert.NoError(t, err)
-	assert.Equal(t, 1297, loc)
-	assert.Equal(t, 16, files)
+	assert.Equal(t, 1297, features.Loc)
+	assert.Equal(t, 16, features.Files)
 }
 
 func TestCountFeaturesWithoutLines(t *testing.T) {
@@ -32,8 +33,112 @@ func TestCountFeaturesWithoutLines(t *testing.T) {
 	assert.NoError(t, err)
 	tree, err := commit.Tree()
 	assert.NoError(t, err)
-	loc, files, err := CountFeatures(repo, tree, nil, nil, false)
+	features, err := CountFeatures(repo, tree, nil, nil, false, nil)
 	assert.NoError(t, err)
-	assert.Equal(t, -1, loc)
-	assert.Equal(t, 16, files)
+	assert.Equal(t, -1, features.Loc)
+	assert.Equal(t, 16, features.Files)
+}
+
+func TestCountFeaturesIncrementally(t *testing.T) {
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	parentTree := lookupTree(t, repo, "ad2c70149ccc529ab26588cde2af1312e6aa0c06")
+	tree := lookupTree(t, repo, "1ae2aabbcdd11948403578a4f2dd32911cc48a00")
+	diffOptions, err := git.DefaultDiffOptions()
+	assert.NoError(t, err)
+	diff, err := repo.DiffTreeToTree(parentTree, tree, &diffOptions)
+	assert.NoError(t, err)
+
+	parentFeatures, err := CountFeatures(repo, parentTree, nil, nil, true, nil)
+	assert.NoError(t, err)
+	features, err := CountFeaturesIncrementally(repo, parentFeatures, diff, nil, nil, true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Features{Loc: 1297, Files: 16}, features)
+
+	fullFeatures, err := CountFeatures(repo, tree, nil, nil, true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fullFeatures, features)
+}
+
+func TestCountFeaturesIncrementallyWithCopies(t *testing.T) {
+	repo, err := git.InitRepository(t.TempDir(), true)
+	assert.NoError(t, err)
+	contents := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	parent := commitFile(t, repo, "a.txt", contents)
+	commit := commitFiles(t, repo, map[string]string{"a.txt": contents + "11\n", "b.txt": contents}, parent)
+	parentTree, err := parent.Tree()
+	assert.NoError(t, err)
+	tree, err := commit.Tree()
+	assert.NoError(t, err)
+	diffOptions, err := git.DefaultDiffOptions()
+	assert.NoError(t, err)
+	diff, err := repo.DiffTreeToTree(parentTree, tree, &diffOptions)
+	assert.NoError(t, err)
+	findOpts, err := git.DefaultDiffFindOptions()
+	assert.NoError(t, err)
+	findOpts.Flags = git.DiffFindCopies
+	assert.NoError(t, diff.FindSimilar(&findOpts))
+
+	var statuses []git.Delta
+	assert.NoError(t, diff.ForEach(func(file git.DiffDelta, progress float64) (git.DiffForEachHunkCallback, error) {
+		statuses = append(statuses, file.Status)
+		return nil, nil
+	}, git.DiffDetailFiles))
+	assert.Equal(t, []git.Delta{git.DeltaModified, git.DeltaCopied}, statuses)
+
+	parentFeatures, err := CountFeatures(repo, parentTree, nil, nil, true, nil)
+	assert.NoError(t, err)
+	features, err := CountFeaturesIncrementally(repo, parentFeatures, diff, nil, nil, true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Features{Loc: 21, Files: 2}, features)
+}
+
+func TestCountFeaturesFromCachedParent(t *testing.T) {
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	parentTree := lookupTree(t, repo, "ad2c70149ccc529ab26588cde2af1312e6aa0c06")
+	tree := lookupTree(t, repo, "1ae2aabbcdd11948403578a4f2dd32911cc48a00")
+	diffOptions, err := git.DefaultDiffOptions()
+	assert.NoError(t, err)
+	diff, err := repo.DiffTreeToTree(parentTree, tree, &diffOptions)
+	assert.NoError(t, err)
+
+	cache := NewFeaturesCache(t.TempDir())
+	err = cache.putFeatures(parentTree.Id(), true, nil, &Features{Loc: 1000, Files: 10})
+	assert.NoError(t, err)
+
+	include := ignore.CompileIgnoreLines("testdata/*")
+	features, err := countFeatures(repo, tree, parentTree, diff, nil, include, true, &Options{FeaturesCache: cache})
+	assert.NoError(t, err)
+	// The made-up parent totals plus the 2 new 4-line files
+	assert.Equal(t, &Features{Loc: 1008, Files: 12}, features)
+
+	cached, ok := cache.getFeatures(tree.Id(), true, nil)
+	assert.True(t, ok)
+	assert.Equal(t, features, cached)
+}
+
+func TestFeaturesCacheWithChangedLanguagesForLogicalLines(t *testing.T) {
+	cache := NewFeaturesCache(t.TempDir())
+	treeOid := new(git.Oid)
+	options := &Options{CountLogicalLines: true, Languages: map[string]string{".tpl": "HTML"}}
+	err := cache.putFeatures(treeOid, true, options, &Features{Loc: 10, Files: 1, CodeLoc: 4, CommentLoc: 6})
+	assert.NoError(t, err)
+
+	_, ok := cache.getFeatures(treeOid, true, &Options{CountLogicalLines: true, Languages: map[string]string{".tpl": "HTML"}})
+	assert.True(t, ok)
+	_, ok = cache.getFeatures(treeOid, true, &Options{CountLogicalLines: true, Languages: map[string]string{".tpl": "Go"}})
+	assert.False(t, ok)
+	_, ok = cache.getFeatures(treeOid, true, &Options{CountLogicalLines: true})
+	assert.False(t, ok)
+}
+
+func lookupTree(t *testing.T, repo *git.Repository, revision string) *git.Tree {
+	oid, err := git.NewOid(revision)
+	assert.NoError(t, err)
+	commit, err := repo.LookupCommit(oid)
+	assert.NoError(t, err)
+	tree, err := commit.Tree()
+	assert.NoError(t, err)
+	return tree
 }
@@ -0,0 +1,61 @@
+package publisher
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Credentials holds the username and password, the token, or the OAuth2 client secret, used to
+// publish to OneReport.
+type Credentials struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	Token        string `yaml:"token"`
+	ClientSecret string `yaml:"client-secret"`
+}
+
+// ReadCredentialsFile reads credentials from a YAML file with username, password, token and
+// client-secret keys.
+// The file must not be readable or writable by anyone but its owner (chmod 600), since it
+// holds a secret.
+func ReadCredentialsFile(path string) (*Credentials, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s: credentials file permissions %#o are too open, run chmod 600 %s", path, info.Mode().Perm(), path)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	credentials := &Credentials{}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	err = decoder.Decode(credentials)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return credentials, nil
+}
+
+// ReadPassword reads a password or token from the first line of r, typically stdin.
+func ReadPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("no password on stdin")
+	}
+	return password, nil
+}
@@ -0,0 +1,54 @@
+package publisher
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadCredentialsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.yml")
+	err := os.WriteFile(path, []byte("username: ci\npassword: secret\n"), 0600)
+	assert.NoError(t, err)
+
+	credentials, err := ReadCredentialsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &Credentials{Username: "ci", Password: "secret"}, credentials)
+}
+
+func TestReadCredentialsFileWithOpenPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not checked on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "credentials.yml")
+	err := os.WriteFile(path, []byte("username: ci\npassword: secret\n"), 0600)
+	assert.NoError(t, err)
+	err = os.Chmod(path, 0644)
+	assert.NoError(t, err)
+
+	_, err = ReadCredentialsFile(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "chmod 600")
+	}
+}
+
+func TestReadCredentialsFileWithUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.yml")
+	err := os.WriteFile(path, []byte("user: ci\n"), 0600)
+	assert.NoError(t, err)
+
+	_, err = ReadCredentialsFile(path)
+	assert.Error(t, err)
+}
+
+func TestReadPassword(t *testing.T) {
+	password, err := ReadPassword(strings.NewReader("secret\r\nignored\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", password)
+
+	_, err = ReadPassword(strings.NewReader(""))
+	assert.Error(t, err)
+}
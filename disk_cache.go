@@ -0,0 +1,107 @@
+package publisher
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diskCache stores JSON values in files under dir, named after their (hex) key. The modification
+// time of an entry is updated each time it is read, so that prune can remove the unused ones.
+type diskCache struct {
+	dir string
+}
+
+func (c diskCache) get(key string, v interface{}) bool {
+	path := c.path(key)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if json.Unmarshal(contents, v) != nil {
+		return false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return true
+}
+
+func (c diskCache) put(key string, v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	path := c.path(key)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	// Write to a unique temporary file first, so concurrent writers never expose a partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(contents)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c diskCache) clear() error {
+	return os.RemoveAll(c.dir)
+}
+
+// prune removes the entries that were neither written nor read in the last maxAge, and the
+// directories that are left empty.
+func (c diskCache) prune(maxAge time.Duration) error {
+	cutoff := time.Now().Add(-maxAge)
+	var dirs []string
+	err := filepath.WalkDir(c.dir, func(path string, entry fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != c.dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			err = os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Deepest first, so a directory whose subdirectories are all removed is removed too
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+	return nil
+}
+
+func (c diskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key[2:])
+}
@@ -4,10 +4,12 @@ go 1.17
 
 require (
 	github.com/SmartBear/lhdiff v0.1.2
+	github.com/klauspost/compress v1.15.9
 	github.com/libgit2/git2go/v33 v33.0.9
 	github.com/onsi/gomega v1.18.1
 	github.com/sabhiram/go-gitignore v0.0.0-20210923224102-525f6e181f06
 	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -22,5 +24,4 @@ require (
 	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
 	golang.org/x/text v0.3.6 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -0,0 +1,70 @@
+package publisher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// HTTPClientConfig holds the settings of the HTTP client used to publish to OneReport.
+type HTTPClientConfig struct {
+	// The time limit for OneReport to respond once a request has been sent (default is no limit). The
+	// time taken to compute and send a streamed changeset does not count.
+	Timeout time.Duration
+	// The proxy to use, e.g. http://proxy.example.com:3128 (default is the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables)
+	ProxyURL string
+	// A PEM file with CA certificates to trust, in addition to the system ones
+	CAFile string
+	// PEM files with a client certificate and its key, for mutual TLS
+	CertFile string
+	KeyFile  string
+	// Do not verify the server certificate. Only for testing.
+	InsecureSkipVerify bool
+}
+
+// NewHTTPClient returns an HTTP client with the given settings.
+func NewHTTPClient(config HTTPClientConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		if config.CertFile == "" || config.KeyFile == "" {
+			return nil, fmt.Errorf("a client certificate needs both a certificate file and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+	transport.ResponseHeaderTimeout = config.Timeout
+
+	return &http.Client{Transport: transport}, nil
+}
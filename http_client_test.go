@@ -0,0 +1,142 @@
+package publisher
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func okHandler(res http.ResponseWriter, req *http.Request) {
+	_, _ = res.Write([]byte("ok"))
+}
+
+// writeServerCA writes the certificate of a TLS test server to a PEM file.
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+	assert.NoError(t, err)
+	return path
+}
+
+// writeClientCert writes a self-signed client certificate and its key to PEM files.
+func writeClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ci"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return cert, certFile, keyFile
+}
+
+func TestNewHTTPClientWithCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(okHandler))
+	defer server.Close()
+
+	_, err := Publish(&MetaChangeset{}, "org", server.URL, nil, nil)
+	assert.Error(t, err)
+
+	client, err := NewHTTPClient(HTTPClientConfig{CAFile: writeServerCA(t, server)})
+	assert.NoError(t, err)
+	txt, err := Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Client: client})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+}
+
+func TestNewHTTPClientWithInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(okHandler))
+	defer server.Close()
+
+	client, err := NewHTTPClient(HTTPClientConfig{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	txt, err := Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Client: client})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+}
+
+func TestNewHTTPClientWithClientCert(t *testing.T) {
+	cert, certFile, keyFile := writeClientCert(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(okHandler))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writeServerCA(t, server)
+
+	client, err := NewHTTPClient(HTTPClientConfig{CAFile: caFile})
+	assert.NoError(t, err)
+	_, err = Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Client: client})
+	assert.Error(t, err)
+
+	client, err = NewHTTPClient(HTTPClientConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	assert.NoError(t, err)
+	txt, err := Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Client: client})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+}
+
+func TestNewHTTPClientWithProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// A proxied request has the absolute url of the target
+		assert.Equal(t, "http://onereport.example.com/api/organization/org/changeset", req.URL.String())
+		_, _ = res.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(HTTPClientConfig{ProxyURL: proxy.URL})
+	assert.NoError(t, err)
+	txt, err := Publish(&MetaChangeset{}, "org", "http://onereport.example.com", nil, &PublishOptions{Client: client})
+	assert.NoError(t, err)
+	assert.Equal(t, "proxied", txt)
+}
+
+func TestNewHTTPClientWithTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(HTTPClientConfig{Timeout: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	_, err = Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Client: client})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timeout awaiting response headers")
+	}
+}
+
+func TestNewHTTPClientWithCertButNoKey(t *testing.T) {
+	_, certFile, _ := writeClientCert(t)
+	_, err := NewHTTPClient(HTTPClientConfig{CertFile: certFile})
+	assert.Error(t, err)
+}
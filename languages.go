@@ -0,0 +1,130 @@
+package publisher
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// LanguageFeatures holds the size of the files in one language.
+type LanguageFeatures struct {
+	// The number of lines of code, or -1 if lines were not counted
+	Loc int `json:"loc"`
+	// The number of files
+	Files int `json:"files"`
+	// The number of code, comment and blank lines in Loc, with Options.CountLogicalLines
+	CodeLoc    int `json:"codeLoc,omitempty"`
+	CommentLoc int `json:"commentLoc,omitempty"`
+	BlankLoc   int `json:"blankLoc,omitempty"`
+}
+
+// DefaultLanguages maps file extensions (or, for files without an extension, file names) to languages.
+// Entries in Options.Languages take precedence.
+var DefaultLanguages = map[string]string{
+	".c":          "C",
+	".h":          "C",
+	".cc":         "C++",
+	".cpp":        "C++",
+	".cxx":        "C++",
+	".hpp":        "C++",
+	".cs":         "C#",
+	".css":        "CSS",
+	".scss":       "CSS",
+	".go":         "Go",
+	".groovy":     "Groovy",
+	".html":       "HTML",
+	".java":       "Java",
+	".js":         "JavaScript",
+	".jsx":        "JavaScript",
+	".mjs":        "JavaScript",
+	".cjs":        "JavaScript",
+	".json":       "JSON",
+	".kt":         "Kotlin",
+	".kts":        "Kotlin",
+	".md":         "Markdown",
+	".php":        "PHP",
+	".py":         "Python",
+	".rb":         "Ruby",
+	".rs":         "Rust",
+	".scala":      "Scala",
+	".sh":         "Shell",
+	".sql":        "SQL",
+	".swift":      "Swift",
+	".ts":         "TypeScript",
+	".tsx":        "TypeScript",
+	".xml":        "XML",
+	".yaml":       "YAML",
+	".yml":        "YAML",
+	"Dockerfile":  "Dockerfile",
+	"Makefile":    "Makefile",
+	"Jenkinsfile": "Groovy",
+}
+
+// otherLanguage is the language of files that are not in DefaultLanguages or Options.Languages.
+const otherLanguage = "Other"
+
+func (o *Options) countLanguages() bool {
+	return o != nil && o.CountLanguages
+}
+
+// language returns the language of the file at filePath.
+func (o *Options) language(filePath string) string {
+	name := path.Base(filePath)
+	ext := strings.ToLower(path.Ext(name))
+	for _, key := range []string{name, ext} {
+		if key == "" {
+			continue
+		}
+		if o != nil {
+			if language, ok := o.Languages[key]; ok {
+				return language
+			}
+		}
+		if language, ok := DefaultLanguages[key]; ok {
+			return language
+		}
+	}
+	return otherLanguage
+}
+
+// languagesKey identifies the language settings, for caching features. They matter for the counts
+// per language, and for the logical lines, whose comment syntax depends on the language.
+func (o *Options) languagesKey() string {
+	if !o.countLanguages() && !o.countLogicalLines() {
+		return ""
+	}
+	keys := make([]string, 0, len(o.Languages))
+	for key := range o.Languages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(&sb, "%s=%s;", key, o.Languages[key])
+	}
+	return sb.String()
+}
+
+// addLanguage adds (sign 1) or removes (sign -1) a file's contribution to language.
+func (f *Features) addLanguage(language string, sign int, file fileFeatures, countLines bool) {
+	if f.Languages == nil {
+		f.Languages = make(map[string]LanguageFeatures)
+	}
+	languageFeatures, ok := f.Languages[language]
+	if !ok && !countLines {
+		languageFeatures.Loc = -1
+	}
+	languageFeatures.Files += sign
+	if countLines {
+		languageFeatures.Loc += sign * file.loc
+		languageFeatures.CodeLoc += sign * file.logicalLines.code
+		languageFeatures.CommentLoc += sign * file.logicalLines.comment
+		languageFeatures.BlankLoc += sign * file.logicalLines.blank
+	}
+	if languageFeatures.Files == 0 {
+		delete(f.Languages, language)
+	} else {
+		f.Languages[language] = languageFeatures
+	}
+}
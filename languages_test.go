@@ -0,0 +1,78 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/sabhiram/go-gitignore"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLanguage(t *testing.T) {
+	var options *Options
+	assert.Equal(t, "Go", options.language("cmd/main.go"))
+	assert.Equal(t, "TypeScript", options.language("src/App.TSX"))
+	assert.Equal(t, "Makefile", options.language("Makefile"))
+	assert.Equal(t, "Other", options.language("testdata/c.unknown"))
+	assert.Equal(t, "Other", options.language("LICENSE"))
+}
+
+func TestLanguageWithOverrides(t *testing.T) {
+	options := &Options{Languages: map[string]string{
+		".txt":    "Text",
+		".go":     "Golang",
+		"LICENSE": "Legal",
+	}}
+	assert.Equal(t, "Text", options.language("testdata/c.txt"))
+	assert.Equal(t, "Golang", options.language("cmd/main.go"))
+	assert.Equal(t, "Legal", options.language("LICENSE"))
+	assert.Equal(t, "Java", options.language("src/Main.java"))
+}
+
+func TestAddLanguage(t *testing.T) {
+	features := newFeatures(true)
+	features.addLanguage("Go", 1, fileFeatures{counted: true, loc: 10}, true)
+	features.addLanguage("Go", 1, fileFeatures{counted: true, loc: 5}, true)
+	features.addLanguage("Java", 1, fileFeatures{counted: true, loc: 7}, true)
+	assert.Equal(t, map[string]LanguageFeatures{
+		"Go":   {Loc: 15, Files: 2},
+		"Java": {Loc: 7, Files: 1},
+	}, features.Languages)
+
+	features.addLanguage("Java", -1, fileFeatures{counted: true, loc: 7}, true)
+	assert.Equal(t, map[string]LanguageFeatures{
+		"Go": {Loc: 15, Files: 2},
+	}, features.Languages)
+}
+
+func TestLanguagesKeyIsStable(t *testing.T) {
+	a := &Options{CountLanguages: true, Languages: map[string]string{".a": "A", ".b": "B", ".c": "C"}}
+	b := &Options{CountLanguages: true, Languages: map[string]string{".c": "C", ".b": "B", ".a": "A"}}
+	assert.Equal(t, a.languagesKey(), b.languagesKey())
+	assert.NotEqual(t, a.languagesKey(), (&Options{CountLanguages: true}).languagesKey())
+}
+
+func TestCountFeaturesWithLanguages(t *testing.T) {
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	tree := lookupTree(t, repo, "1ae2aabbcdd11948403578a4f2dd32911cc48a00")
+	features, err := CountFeatures(repo, tree, nil, nil, true, &Options{CountLanguages: true})
+	assert.NoError(t, err)
+
+	files := 0
+	loc := 0
+	for _, languageFeatures := range features.Languages {
+		files += languageFeatures.Files
+		loc += languageFeatures.Loc
+	}
+	assert.Equal(t, features.Files, files)
+	assert.Equal(t, features.Loc, loc)
+	assert.Contains(t, features.Languages, "Go")
+
+	include := ignore.CompileIgnoreLines("testdata/*")
+	features, err = CountFeatures(repo, tree, nil, include, true, &Options{
+		CountLanguages: true,
+		Languages:      map[string]string{".txt": "Text"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, features.Files, features.Languages["Text"].Files)
+}
@@ -0,0 +1,126 @@
+package publisher
+
+import (
+	"github.com/SmartBear/lhdiff"
+	"github.com/libgit2/git2go/v33"
+)
+
+// lineMappingsJob describes the line mappings to compute for a change.
+// A nil oid means the file does not exist on that side of the change.
+type lineMappingsJob struct {
+	oldOid *git.Oid
+	newOid *git.Oid
+}
+
+// pendingChange is a change whose line mappings, if it has a job, are yet to be computed.
+type pendingChange struct {
+	change Change
+	job    *lineMappingsJob
+}
+
+type lineMappingsResult struct {
+	lineMappings [][]int
+	err          error
+}
+
+// streamLineMappings computes the line mappings of changes on Options.Concurrency workers, and calls
+// emit with each change in order, as soon as it and all the changes before it are computed. At most
+// a few more changes than Options.Concurrency are computed ahead of emit, which bounds the memory
+// used by line mappings.
+func streamLineMappings(repo *git.Repository, changes []pendingChange, options *Options, emit func(Change) error) error {
+	concurrency := options.concurrency()
+	cache := options.cache()
+	// Each change's result arrives on its own channel. The buffer of results bounds the changes in flight.
+	results := make(chan chan lineMappingsResult, concurrency)
+	workers := make(chan struct{}, concurrency)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(results)
+		for _, change := range changes {
+			result := make(chan lineMappingsResult, 1)
+			select {
+			case results <- result:
+			case <-done:
+				return
+			}
+			if change.job == nil {
+				result <- lineMappingsResult{lineMappings: change.change.LineMappings}
+				continue
+			}
+			select {
+			case workers <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(job *lineMappingsJob) {
+				defer func() { <-workers }()
+				lineMappings, err := job.lineMappings(repo, cache, options)
+				result <- lineMappingsResult{lineMappings: lineMappings, err: err}
+			}(change.job)
+		}
+	}()
+
+	for _, change := range changes {
+		result := <-<-results
+		if result.err != nil {
+			return result.err
+		}
+		change.change.LineMappings = result.lineMappings
+		err := emit(change.change)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (job *lineMappingsJob) lineMappings(repo *git.Repository, cache *LineMappingsCache, options *Options) ([][]int, error) {
+	var key string
+	if cache != nil {
+		key = lineMappingsCacheKey(oidString(job.oldOid), oidString(job.newOid), options.lhdiffContextSize(), options.lhdiffIncludeIdenticalLines())
+		if lineMappings, ok := cache.getLineMappings(key); ok {
+			return lineMappings, nil
+		}
+	}
+
+	oldContents, err := blobContents(repo, job.oldOid)
+	if err != nil {
+		return nil, err
+	}
+	newContents, err := blobContents(repo, job.newOid)
+	if err != nil {
+		return nil, err
+	}
+	lineMappings, err := lhdiff.Lhdiff(oldContents, newContents, options.lhdiffContextSize(), options.lhdiffIncludeIdenticalLines())
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		err = cache.put(key, lineMappings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lineMappings, nil
+}
+
+func blobContents(repo *git.Repository, oid *git.Oid) (string, error) {
+	if oid == nil {
+		return "", nil
+	}
+	blob, err := repo.LookupBlob(oid)
+	if err != nil {
+		return "", err
+	}
+	return string(blob.Contents()), nil
+}
+
+func oidString(oid *git.Oid) string {
+	if oid == nil {
+		return ""
+	}
+	return oid.String()
+}
@@ -0,0 +1,40 @@
+package publisher
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"time"
+)
+
+// LineMappingsCache stores computed line mappings on disk, keyed by the old and new blob ids
+// and the lhdiff parameters, so identical blob pairs are only diffed once.
+type LineMappingsCache struct {
+	diskCache
+}
+
+// NewLineMappingsCache returns a cache that stores line mappings in dir.
+func NewLineMappingsCache(dir string) *LineMappingsCache {
+	return &LineMappingsCache{diskCache{dir: dir}}
+}
+
+// Clear removes all cached line mappings.
+func (c *LineMappingsCache) Clear() error {
+	return c.clear()
+}
+
+// Prune removes the cached line mappings that were not used in the last maxAge.
+func (c *LineMappingsCache) Prune(maxAge time.Duration) error {
+	return c.prune(maxAge)
+}
+
+func (c *LineMappingsCache) getLineMappings(key string) ([][]int, bool) {
+	var lineMappings [][]int
+	ok := c.get(key, &lineMappings)
+	return lineMappings, ok
+}
+
+func lineMappingsCacheKey(oldOid string, newOid string, contextSize int, includeIdenticalLines bool) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "%s:%s:%d:%t", oldOid, newOid, contextSize, includeIdenticalLines)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
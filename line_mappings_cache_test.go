@@ -0,0 +1,65 @@
+package publisher
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLineMappingsCache(t *testing.T) {
+	cache := NewLineMappingsCache(t.TempDir())
+	key := lineMappingsCacheKey("", "96b0c5a1e2d3a4c1b1b1e6b9a3c8b9b3f9c3c5a6", 4, false)
+
+	_, ok := cache.getLineMappings(key)
+	assert.False(t, ok)
+
+	err := cache.put(key, [][]int{{-1, 0}, {-1, 1}})
+	assert.NoError(t, err)
+	lineMappings, ok := cache.getLineMappings(key)
+	assert.True(t, ok)
+	assert.Equal(t, [][]int{{-1, 0}, {-1, 1}}, lineMappings)
+
+	err = cache.Clear()
+	assert.NoError(t, err)
+	_, ok = cache.getLineMappings(key)
+	assert.False(t, ok)
+}
+
+func TestLineMappingsCacheKeyIncludesLhdiffParameters(t *testing.T) {
+	a := lineMappingsCacheKey("aaa", "bbb", 4, false)
+	assert.NotEqual(t, a, lineMappingsCacheKey("bbb", "aaa", 4, false))
+	assert.NotEqual(t, a, lineMappingsCacheKey("aaa", "bbb", 3, false))
+	assert.NotEqual(t, a, lineMappingsCacheKey("aaa", "bbb", 4, true))
+}
+
+func TestLineMappingsCachePrunesUnusedEntries(t *testing.T) {
+	cache := NewLineMappingsCache(t.TempDir())
+	oldKey := lineMappingsCacheKey("aaa", "bbb", 4, false)
+	usedKey := lineMappingsCacheKey("aaa", "ccc", 4, false)
+	newKey := lineMappingsCacheKey("aaa", "ddd", 4, false)
+	for _, key := range []string{oldKey, usedKey, newKey} {
+		assert.NoError(t, cache.put(key, [][]int{{0, 0}}))
+	}
+	lastMonth := time.Now().Add(-30 * 24 * time.Hour)
+	assert.NoError(t, os.Chtimes(cache.path(oldKey), lastMonth, lastMonth))
+	assert.NoError(t, os.Chtimes(cache.path(usedKey), lastMonth, lastMonth))
+	_, ok := cache.getLineMappings(usedKey)
+	assert.True(t, ok)
+
+	err := cache.Prune(7 * 24 * time.Hour)
+	assert.NoError(t, err)
+	_, ok = cache.getLineMappings(oldKey)
+	assert.False(t, ok)
+	assert.NoFileExists(t, cache.path(oldKey))
+	_, ok = cache.getLineMappings(usedKey)
+	assert.True(t, ok)
+	_, ok = cache.getLineMappings(newKey)
+	assert.True(t, ok)
+}
+
+func TestPruneMissingLineMappingsCache(t *testing.T) {
+	cache := NewLineMappingsCache(filepath.Join(t.TempDir(), "missing"))
+	assert.NoError(t, cache.Prune(time.Hour))
+}
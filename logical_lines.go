@@ -0,0 +1,139 @@
+package publisher
+
+import (
+	"strings"
+)
+
+// commentSyntax describes how comments are written in a language.
+type commentSyntax struct {
+	line       []string
+	blockStart string
+	blockEnd   string
+}
+
+var (
+	cStyleComments  = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/"}
+	hashComments    = commentSyntax{line: []string{"#"}}
+	markupComments  = commentSyntax{blockStart: "<!--", blockEnd: "-->"}
+	noComments      = commentSyntax{}
+	commentSyntaxes = map[string]commentSyntax{
+		"C":          cStyleComments,
+		"C++":        cStyleComments,
+		"C#":         cStyleComments,
+		"CSS":        cStyleComments,
+		"Go":         cStyleComments,
+		"Groovy":     cStyleComments,
+		"Java":       cStyleComments,
+		"JavaScript": cStyleComments,
+		"Kotlin":     cStyleComments,
+		"PHP":        {line: []string{"//", "#"}, blockStart: "/*", blockEnd: "*/"},
+		"Rust":       cStyleComments,
+		"Scala":      cStyleComments,
+		"Swift":      cStyleComments,
+		"TypeScript": cStyleComments,
+		"Dockerfile": hashComments,
+		"Makefile":   hashComments,
+		"Python":     hashComments,
+		"Ruby":       hashComments,
+		"Shell":      hashComments,
+		"YAML":       hashComments,
+		"SQL":        {line: []string{"--"}, blockStart: "/*", blockEnd: "*/"},
+		"HTML":       markupComments,
+		"Markdown":   markupComments,
+		"XML":        markupComments,
+	}
+)
+
+// logicalLines holds the number of code, comment and blank lines in a file.
+type logicalLines struct {
+	code    int
+	comment int
+	blank   int
+}
+
+// countLogicalLines classifies each line of contents as code, comment or blank. Lines with both code
+// and a comment count as code. This is a heuristic: comment markers inside string literals are not
+// recognised as such. The three counts always add up to lineCount(contents).
+func countLogicalLines(contents string, syntax commentSyntax) logicalLines {
+	var counts logicalLines
+	if contents == "" {
+		return counts
+	}
+	lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	inBlock := false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case inBlock:
+			inBlock = !syntax.closesBlock(&line)
+			if !inBlock && syntax.hasCode(line, &inBlock) {
+				counts.code++
+			} else {
+				counts.comment++
+			}
+		case line == "":
+			counts.blank++
+		case syntax.hasCode(line, &inBlock):
+			counts.code++
+		default:
+			counts.comment++
+		}
+	}
+	return counts
+}
+
+// hasCode returns whether line, which does not start inside a block comment, contains code.
+// inBlock is set if the line ends inside a block comment.
+func (s commentSyntax) hasCode(line string, inBlock *bool) bool {
+	for line != "" {
+		if s.startsLineComment(line) {
+			return false
+		}
+		if s.blockStart == "" || !strings.HasPrefix(line, s.blockStart) {
+			// Any trailing comment may open a block, but the line is code either way
+			if s.blockStart != "" {
+				if i := strings.LastIndex(line, s.blockStart); i > 0 && !strings.Contains(line[i:], s.blockEnd) {
+					*inBlock = true
+				}
+			}
+			return true
+		}
+		line = line[len(s.blockStart):]
+		if !s.closesBlock(&line) {
+			*inBlock = true
+			return false
+		}
+		line = strings.TrimSpace(line)
+	}
+	return false
+}
+
+// closesBlock returns whether line closes a block comment, and if so, sets line to what follows it.
+func (s commentSyntax) closesBlock(line *string) bool {
+	i := strings.Index(*line, s.blockEnd)
+	if i < 0 {
+		return false
+	}
+	*line = strings.TrimSpace((*line)[i+len(s.blockEnd):])
+	return true
+}
+
+func (s commentSyntax) startsLineComment(line string) bool {
+	for _, marker := range s.line {
+		if strings.HasPrefix(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) countLogicalLines() bool {
+	return o != nil && o.CountLogicalLines
+}
+
+func (o *Options) commentSyntax(filePath string) commentSyntax {
+	if syntax, ok := commentSyntaxes[o.language(filePath)]; ok {
+		return syntax
+	}
+	return noComments
+}
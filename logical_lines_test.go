@@ -0,0 +1,53 @@
+package publisher
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCountLogicalLinesWithCStyleComments(t *testing.T) {
+	contents := `// Copyright header
+/*
+ * License
+ */
+package main
+
+import "fmt" // trailing comment
+
+/* inline */ func main() {
+	fmt.Println("hello") /* starts a block
+	still in the block */
+}
+`
+	counts := countLogicalLines(contents, cStyleComments)
+	assert.Equal(t, logicalLines{code: 5, comment: 5, blank: 2}, counts)
+	assert.Equal(t, lineCount(contents), counts.code+counts.comment+counts.blank)
+}
+
+func TestCountLogicalLinesWithHashComments(t *testing.T) {
+	contents := "#!/bin/sh\n\n# say hello\necho hello # trailing\n  \n"
+	counts := countLogicalLines(contents, hashComments)
+	assert.Equal(t, logicalLines{code: 1, comment: 2, blank: 2}, counts)
+}
+
+func TestCountLogicalLinesWithMarkupComments(t *testing.T) {
+	contents := "<!--\n  comment\n--> <root>\n<!-- one line --></root>"
+	counts := countLogicalLines(contents, markupComments)
+	assert.Equal(t, logicalLines{code: 2, comment: 2}, counts)
+	assert.Equal(t, lineCount(contents), counts.code+counts.comment+counts.blank)
+}
+
+func TestCountLogicalLinesWithoutComments(t *testing.T) {
+	contents := "{\n\n  \"a\": \"// not a comment\"\n}\n"
+	counts := countLogicalLines(contents, noComments)
+	assert.Equal(t, logicalLines{code: 3, blank: 1}, counts)
+	assert.Equal(t, logicalLines{}, countLogicalLines("", noComments))
+}
+
+func TestCommentSyntax(t *testing.T) {
+	options := &Options{Languages: map[string]string{".tpl": "HTML"}}
+	assert.Equal(t, cStyleComments, options.commentSyntax("main.go"))
+	assert.Equal(t, hashComments, options.commentSyntax("scripts/install-libgit2.sh"))
+	assert.Equal(t, markupComments, options.commentSyntax("index.tpl"))
+	assert.Equal(t, noComments, options.commentSyntax("go.sum"))
+}
@@ -3,9 +3,9 @@ package publisher
 import (
 	"crypto/sha1"
 	"fmt"
-	"github.com/SmartBear/lhdiff"
 	"github.com/libgit2/git2go/v33"
 	"github.com/sabhiram/go-gitignore"
+	"io"
 	"path/filepath"
 )
 
@@ -19,12 +19,26 @@ type MetaChangeset struct {
 	Loc int `json:"loc"`
 	// The total number of files in Sha (filtered by .onereportinclude and .onereportexluce
 	Files int `json:"files"`
+	// The number of files in Files that are larger than Options.MaxBlobSize, and not counted in Loc
+	OversizedFiles int `json:"oversizedFiles,omitempty"`
+	// The number of code, comment and blank lines in Loc, with Options.CountLogicalLines
+	CodeLoc    int `json:"codeLoc,omitempty"`
+	CommentLoc int `json:"commentLoc,omitempty"`
+	BlankLoc   int `json:"blankLoc,omitempty"`
+	// The lines of code and files in each language, with Options.CountLanguages
+	Languages map[string]LanguageFeatures `json:"languages,omitempty"`
 }
 
 type Change struct {
+	// The entry in MetaChangeset.OldShas this change was diffed against
+	OldSha       string  `json:"oldSha"`
 	OldPath      string  `json:"oldPath"`
 	NewPath      string  `json:"newPath"`
 	LineMappings [][]int `json:"lineMappings"`
+	// Whether the old or new file is binary, in which case there are no line mappings
+	Binary bool `json:"binary,omitempty"`
+	// Whether the old or new file is larger than Options.MaxBlobSize, in which case there are no line mappings
+	Oversized bool `json:"oversized,omitempty"`
 }
 
 func MakeMetaChangeset(
@@ -36,7 +50,52 @@ func MakeMetaChangeset(
 	exclude *ignore.GitIgnore,
 	include *ignore.GitIgnore,
 	includeLines bool,
+	options *Options,
 ) (*MetaChangeset, error) {
+	stream, err := NewMetaChangesetStream(oldSha, sha, usePaths, remote, repo, exclude, include, includeLines, options)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]Change, 0)
+	changeset, err := stream.makeChanges(func(change Change) error {
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	changeset.Changes = changes
+	return changeset, nil
+}
+
+// MetaChangesetStream makes the same changeset as MakeMetaChangeset, but hands out each Change as
+// soon as its line mappings are computed, so that the changes never all need to be in memory.
+type MetaChangesetStream struct {
+	repo         *git.Repository
+	newTree      *git.Tree
+	oldCommits   []*git.Commit
+	usePaths     bool
+	exclude      *ignore.GitIgnore
+	include      *ignore.GitIgnore
+	includeLines bool
+	options      *Options
+	// The changeset, without changes or features
+	header MetaChangeset
+}
+
+// NewMetaChangesetStream looks up the commits of a changeset, without diffing them yet.
+// The parameters are the same as MakeMetaChangeset's.
+func NewMetaChangesetStream(
+	oldSha string,
+	sha string,
+	usePaths bool,
+	remote string,
+	repo *git.Repository,
+	exclude *ignore.GitIgnore,
+	include *ignore.GitIgnore,
+	includeLines bool,
+	options *Options,
+) (*MetaChangesetStream, error) {
 	if exclude == nil {
 		exclude, _ = ignore.CompileIgnoreFile(filepath.Join(repo.Workdir(), ".onereportignore"))
 	}
@@ -69,7 +128,6 @@ func MakeMetaChangeset(
 
 	newCommit, err := repo.LookupCommit(newOid)
 	if err != nil {
-		fmt.Printf("FAILED COMMIT LOOKUP")
 		return nil, err
 	}
 	newTree, err := newCommit.Tree()
@@ -94,9 +152,55 @@ func MakeMetaChangeset(
 			oldCommits = append(oldCommits, newCommit.Parent(i))
 		}
 	}
-	changes := make([]Change, 0)
 
-	for _, oldCommit := range oldCommits {
+	parentShas := make([]string, len(oldCommits))
+	for i, parentCommit := range oldCommits {
+		parentShas[i] = parentCommit.Id().String()
+	}
+
+	return &MetaChangesetStream{
+		repo:         repo,
+		newTree:      newTree,
+		oldCommits:   oldCommits,
+		usePaths:     usePaths,
+		exclude:      exclude,
+		include:      include,
+		includeLines: includeLines,
+		options:      options,
+		header: MetaChangeset{
+			Remote:   remote,
+			UnixTime: newCommit.Committer().When.Unix(),
+			OldShas:  parentShas,
+			Sha:      newOid.String(),
+		},
+	}, nil
+}
+
+// IdempotencyKey identifies the changeset, like IdempotencyKey.
+func (s *MetaChangesetStream) IdempotencyKey() string {
+	return IdempotencyKey(&s.header)
+}
+
+// Encode writes the changeset to w as JSON, encoding each change as soon as it is computed.
+func (s *MetaChangesetStream) Encode(w io.Writer) error {
+	return encodeStreaming(w, &s.header, s.makeChanges)
+}
+
+// makeChanges diffs the commits, and calls onChange with each change in order. It returns the
+// changeset without its changes.
+func (s *MetaChangesetStream) makeChanges(onChange func(Change) error) (*MetaChangeset, error) {
+	repo, exclude, include, options := s.repo, s.exclude, s.include, s.options
+	odb, err := repo.Odb()
+	if err != nil {
+		return nil, err
+	}
+	defer odb.Free()
+	var changes []pendingChange
+	var firstParentTree *git.Tree
+	var firstParentDiff *git.Diff
+
+	for i, oldCommit := range s.oldCommits {
+		parentSha := oldCommit.Id().String()
 		oldTree, err := oldCommit.Tree()
 		if err != nil {
 			return nil, err
@@ -106,10 +210,14 @@ func MakeMetaChangeset(
 			return nil, err
 		}
 
-		diff, err := repo.DiffTreeToTree(oldTree, newTree, &diffOptions)
+		diff, err := repo.DiffTreeToTree(oldTree, s.newTree, &diffOptions)
 		if err != nil {
 			return nil, err
 		}
+		if i == 0 {
+			firstParentTree = oldTree
+			firstParentDiff = diff
+		}
 
 		findOpts, err := git.DefaultDiffFindOptions()
 		if err != nil {
@@ -137,81 +245,80 @@ func MakeMetaChangeset(
 			newPath := ""
 			oldExists := file.OldFile.Flags&git.DiffFlagExists != 0
 			newExists := file.NewFile.Flags&git.DiffFlagExists != 0
+			oversized, err := isOversized(odb, file, options.maxBlobSize())
+			if err != nil {
+				return nil, err
+			}
+			binary, err := isBinary(repo, odb, file, oversized)
+			if err != nil {
+				return nil, err
+			}
+			if binary && options.excludeBinary() {
+				return callback, nil
+			}
 
 			if oldExists {
-				if usePaths {
+				if s.usePaths {
 					oldPath = file.OldFile.Path
 				} else {
-					oldPath = hashString(file.OldFile.Path)
+					oldPath = options.HashPath(file.OldFile.Path)
 				}
 			}
 			if newExists {
-				if usePaths {
+				if s.usePaths {
 					newPath = file.NewFile.Path
 				} else {
-					newPath = hashString(file.NewFile.Path)
+					newPath = options.HashPath(file.NewFile.Path)
 				}
 			}
 
-			var lineMappings [][]int
-			if includeLines {
-				var oldContents string
-				var newContents string
-
+			change := pendingChange{
+				change: Change{
+					OldSha:       parentSha,
+					OldPath:      oldPath,
+					NewPath:      newPath,
+					LineMappings: make([][]int, 0),
+					Binary:       binary,
+					Oversized:    oversized,
+				},
+			}
+			if s.includeLines && !binary && !oversized {
+				change.job = &lineMappingsJob{}
 				if oldExists {
-					oldBlob, err := repo.LookupBlob(file.OldFile.Oid)
-					if err != nil {
-						return nil, err
-					}
-					oldContents = string(oldBlob.Contents())
-				} else {
-					oldContents = ""
+					change.job.oldOid = file.OldFile.Oid
 				}
-
 				if newExists {
-					newBlob, err := repo.LookupBlob(file.NewFile.Oid)
-					if err != nil {
-						return nil, err
-					}
-					newContents = string(newBlob.Contents())
-				} else {
-					newContents = ""
+					change.job.newOid = file.NewFile.Oid
 				}
-				lineMappings, err = lhdiff.Lhdiff(oldContents, newContents, 4, false)
-			} else {
-				lineMappings = make([][]int, 0)
-			}
-			change := Change{
-				OldPath:      oldPath,
-				NewPath:      newPath,
-				LineMappings: lineMappings,
 			}
 			changes = append(changes, change)
 
 			return callback, nil
 		}, git.DiffDetailFiles)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	loc, files, err := CountFeatures(repo, newTree, exclude, include, includeLines)
+	err = streamLineMappings(repo, changes, options, onChange)
 	if err != nil {
 		return nil, err
 	}
 
-	parentShas := make([]string, len(oldCommits))
-	for i, parentCommit := range oldCommits {
-		parentShas[i] = parentCommit.Id().String()
+	features, err := countFeatures(repo, s.newTree, firstParentTree, firstParentDiff, exclude, include, s.includeLines, options)
+	if err != nil {
+		return nil, err
 	}
 
-	changeset := &MetaChangeset{
-		Remote:   remote,
-		UnixTime: newCommit.Committer().When.Unix(),
-		OldShas:  parentShas,
-		Sha:      sha,
-		Changes:  changes,
-		Loc:      loc,
-		Files:    files,
-	}
-	return changeset, nil
+	changeset := s.header
+	changeset.Loc = features.Loc
+	changeset.Files = features.Files
+	changeset.OversizedFiles = features.OversizedFiles
+	changeset.CodeLoc = features.CodeLoc
+	changeset.CommentLoc = features.CommentLoc
+	changeset.BlankLoc = features.BlankLoc
+	changeset.Languages = features.Languages
+	return &changeset, nil
 }
 
 func hashString(s string) string {
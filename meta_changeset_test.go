@@ -1,13 +1,17 @@
 package publisher
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/libgit2/git2go/v33"
 	"github.com/onsi/gomega"
 	"github.com/sabhiram/go-gitignore"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMakeMetaChangesetNoExcludeAndIgnore(t *testing.T) {
@@ -17,7 +21,7 @@ func TestMakeMetaChangesetNoExcludeAndIgnore(t *testing.T) {
 	sha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, true)
+	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, true, nil)
 	assert.NoError(t, err)
 
 	j, err := json.MarshalIndent(metaChangeset, "", "  ")
@@ -32,6 +36,7 @@ func TestMakeMetaChangesetNoExcludeAndIgnore(t *testing.T) {
       "files": 7,
 	  "changes": [
 		{
+		  "oldSha": "ad2c70149ccc529ab26588cde2af1312e6aa0c06",
 		  "oldPath": "",
 		  "newPath": "testdata/a.txt",
 		  "lineMappings": [
@@ -42,6 +47,7 @@ func TestMakeMetaChangesetNoExcludeAndIgnore(t *testing.T) {
 		  ]
 		},
 		{
+		  "oldSha": "ad2c70149ccc529ab26588cde2af1312e6aa0c06",
 		  "oldPath": "",
 		  "newPath": "testdata/b.txt",
 		  "lineMappings": [
@@ -64,7 +70,7 @@ func TestMakeMetaChangesetWithExclude(t *testing.T) {
 	sha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, ignore.CompileIgnoreLines("testdata/a.*"), nil, true)
+	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, ignore.CompileIgnoreLines("testdata/a.*"), nil, true, nil)
 	assert.NoError(t, err)
 
 	j, err := json.MarshalIndent(metaChangeset, "", "  ")
@@ -79,6 +85,7 @@ func TestMakeMetaChangesetWithExclude(t *testing.T) {
       "files": 6,
 	  "changes": [
 		{
+		  "oldSha": "ad2c70149ccc529ab26588cde2af1312e6aa0c06",
 		  "oldPath": "",
 		  "newPath": "testdata/b.txt",
 		  "lineMappings": [
@@ -100,7 +107,7 @@ func TestMakeMetaChangesetWithInclude(t *testing.T) {
 	sha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, ignore.CompileIgnoreLines("testdata/b.*"), false)
+	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, ignore.CompileIgnoreLines("testdata/b.*"), false, nil)
 	assert.NoError(t, err)
 
 	expected := &MetaChangeset{
@@ -112,6 +119,7 @@ func TestMakeMetaChangesetWithInclude(t *testing.T) {
 		Files:    1,
 		Changes: []Change{
 			{
+				OldSha:       "ad2c70149ccc529ab26588cde2af1312e6aa0c06",
 				OldPath:      "",
 				NewPath:      "testdata/b.txt",
 				LineMappings: [][]int{},
@@ -127,7 +135,7 @@ func TestMakeMetaChangesetWithNilOldSha(t *testing.T) {
 	sha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, ignore.CompileIgnoreLines("testdata/b.*"), false)
+	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, ignore.CompileIgnoreLines("testdata/b.*"), false, nil)
 	assert.NoError(t, err)
 
 	expected := &MetaChangeset{
@@ -139,6 +147,7 @@ func TestMakeMetaChangesetWithNilOldSha(t *testing.T) {
 		Files:    1,
 		Changes: []Change{
 			{
+				OldSha:       "ad2c70149ccc529ab26588cde2af1312e6aa0c06",
 				OldPath:      "",
 				NewPath:      "testdata/b.txt",
 				LineMappings: [][]int{},
@@ -155,7 +164,7 @@ func TestMakeMetaChangesetWithDeleteAndModification(t *testing.T) {
 	sha := "e57bfde5c3591a14c0e199c900174a08b0b94312"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	changeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, false)
+	changeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, false, nil)
 	assert.NoError(t, err)
 
 	j, err := json.MarshalIndent(changeset, "", "  ")
@@ -170,11 +179,13 @@ func TestMakeMetaChangesetWithDeleteAndModification(t *testing.T) {
       "files": 6,
 	  "changes": [
 		{
+		  "oldSha": "1ae2aabbcdd11948403578a4f2dd32911cc48a00",
 		  "oldPath": "testdata/a.txt",
 		  "newPath": "",
 		  "lineMappings": []
 		},
 		{
+		  "oldSha": "1ae2aabbcdd11948403578a4f2dd32911cc48a00",
 		  "oldPath": "testdata/b.txt",
 		  "newPath": "testdata/b.txt",
 		  "lineMappings": []
@@ -192,7 +203,7 @@ func TestMakeMetaChangesetWithMovedFile(t *testing.T) {
 	sha := "082022d1a8bac6a768b0fc9243f3f37ede8c0fc3"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, false)
+	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, false, nil)
 	assert.NoError(t, err)
 
 	j, err := json.MarshalIndent(metaChangeset, "", "  ")
@@ -207,6 +218,7 @@ func TestMakeMetaChangesetWithMovedFile(t *testing.T) {
       "files": 6,
 	  "changes": [
 		{
+		  "oldSha": "e57bfde5c3591a14c0e199c900174a08b0b94312",
 		  "oldPath": "testdata/b.txt",
 		  "newPath": "testdata/c.txt",
 		  "lineMappings": []
@@ -224,7 +236,7 @@ func TestMakeMetaChangesetWithHashedPaths(t *testing.T) {
 	sha := "082022d1a8bac6a768b0fc9243f3f37ede8c0fc3"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	changeset, err := MakeMetaChangeset(oldSha, sha, false, remote, repo, nil, nil, false)
+	changeset, err := MakeMetaChangeset(oldSha, sha, false, remote, repo, nil, nil, false, nil)
 	assert.NoError(t, err)
 
 	j, err := json.MarshalIndent(changeset, "", "  ")
@@ -239,6 +251,7 @@ func TestMakeMetaChangesetWithHashedPaths(t *testing.T) {
       "files": 6,
 	  "changes": [
 		{
+		  "oldSha": "e57bfde5c3591a14c0e199c900174a08b0b94312",
 		  "oldPath": "858458ace7ba8e65ef6427310bd96db9cbacc26d",
 		  "newPath": "d45df6aad2a7e9dc7ff0309d1a916f0d75dcad7a",
 		  "lineMappings": []
@@ -255,7 +268,7 @@ func TestMakeMetaChangesetWithoutRemote(t *testing.T) {
 	sha := "082022d1a8bac6a768b0fc9243f3f37ede8c0fc3"
 	repo, err := git.OpenRepository(".")
 	assert.NoError(t, err)
-	metaChangeset, err := MakeMetaChangeset(oldShas, sha, false, "", repo, nil, nil, false)
+	metaChangeset, err := MakeMetaChangeset(oldShas, sha, false, "", repo, nil, nil, false, nil)
 	assert.NoError(t, err)
 
 	j, err := json.MarshalIndent(metaChangeset, "", "  ")
@@ -270,6 +283,7 @@ func TestMakeMetaChangesetWithoutRemote(t *testing.T) {
       "files": 6,
 	  "changes": [
 		{
+		  "oldSha": "e57bfde5c3591a14c0e199c900174a08b0b94312",
 		  "oldPath": "858458ace7ba8e65ef6427310bd96db9cbacc26d",
 		  "newPath": "d45df6aad2a7e9dc7ff0309d1a916f0d75dcad7a",
 		  "lineMappings": []
@@ -288,6 +302,7 @@ func TestMakeMetaChangesetWithoutRemote(t *testing.T) {
 		  "files": 6,
 		  "changes": [
 			{
+			  "oldSha": "e57bfde5c3591a14c0e199c900174a08b0b94312",
 			  "oldPath": "858458ace7ba8e65ef6427310bd96db9cbacc26d",
 			  "newPath": "d45df6aad2a7e9dc7ff0309d1a916f0d75dcad7a",
 			  "lineMappings": []
@@ -298,3 +313,157 @@ func TestMakeMetaChangesetWithoutRemote(t *testing.T) {
 
 	g.Ω(string(j)).Should(gomega.MatchJSON(expected))
 }
+
+func TestMakeMetaChangesetWithConcurrency(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-metaChangeset-publisher.git"
+	oldSha := "ad2c70149ccc529ab26588cde2af1312e6aa0c06"
+	sha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	serial, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, true, &Options{Concurrency: 1})
+	assert.NoError(t, err)
+	parallel, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, true, &Options{Concurrency: 8})
+	assert.NoError(t, err)
+
+	assert.Equal(t, serial, parallel)
+}
+
+func TestMakeMetaChangesetWithMaxBlobSize(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-metaChangeset-publisher.git"
+	oldSha := "ad2c70149ccc529ab26588cde2af1312e6aa0c06"
+	sha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, ignore.CompileIgnoreLines("testdata/*"), true, &Options{MaxBlobSize: 1})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Change{
+		{
+			OldSha:       "ad2c70149ccc529ab26588cde2af1312e6aa0c06",
+			OldPath:      "",
+			NewPath:      "testdata/a.txt",
+			LineMappings: [][]int{},
+			Oversized:    true,
+		},
+		{
+			OldSha:       "ad2c70149ccc529ab26588cde2af1312e6aa0c06",
+			OldPath:      "",
+			NewPath:      "testdata/b.txt",
+			LineMappings: [][]int{},
+			Oversized:    true,
+		},
+	}, metaChangeset.Changes)
+}
+
+// commitFile commits a single file to the HEAD of repo.
+func commitFile(t *testing.T, repo *git.Repository, name string, contents string, parents ...*git.Commit) *git.Commit {
+	return commitFiles(t, repo, map[string]string{name: contents}, parents...)
+}
+
+// commitFiles commits a tree of the given files on HEAD, which must point to the first parent.
+func commitFiles(t *testing.T, repo *git.Repository, files map[string]string, parents ...*git.Commit) *git.Commit {
+	builder, err := repo.TreeBuilder()
+	assert.NoError(t, err)
+	var names []string
+	for name, contents := range files {
+		blobOid, err := repo.CreateBlobFromBuffer([]byte(contents))
+		assert.NoError(t, err)
+		assert.NoError(t, builder.Insert(name, blobOid, git.FilemodeBlob))
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	treeOid, err := builder.Write()
+	assert.NoError(t, err)
+	tree, err := repo.LookupTree(treeOid)
+	assert.NoError(t, err)
+	signature := &git.Signature{Name: "test", Email: "test@example.com", When: time.Unix(1644410531, 0)}
+	commitOid, err := repo.CreateCommit("HEAD", signature, signature, "commit "+strings.Join(names, ", "), tree, parents...)
+	assert.NoError(t, err)
+	commit, err := repo.LookupCommit(commitOid)
+	assert.NoError(t, err)
+	return commit
+}
+
+func TestMakeMetaChangesetForHeadHasDistinctIdempotencyKeys(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-metaChangeset-publisher.git"
+	repo, err := git.InitRepository(t.TempDir(), true)
+	assert.NoError(t, err)
+
+	first := commitFile(t, repo, "a.txt", "a\n")
+	firstChangeset, err := MakeMetaChangeset("", "", true, remote, repo, nil, nil, false, nil)
+	assert.NoError(t, err)
+	second := commitFile(t, repo, "b.txt", "b\n", first)
+	secondChangeset, err := MakeMetaChangeset("", "", true, remote, repo, nil, nil, false, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, first.Id().String(), firstChangeset.Sha)
+	assert.Equal(t, second.Id().String(), secondChangeset.Sha)
+	assert.NotEqual(t, IdempotencyKey(firstChangeset), IdempotencyKey(secondChangeset))
+}
+
+func TestMetaChangesetStreamEncodesLikeMakeMetaChangeset(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-metaChangeset-publisher.git"
+	oldSha := "ad2c70149ccc529ab26588cde2af1312e6aa0c06"
+	sha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	metaChangeset, err := MakeMetaChangeset(oldSha, sha, true, remote, repo, nil, nil, true, &Options{Concurrency: 2})
+	assert.NoError(t, err)
+	expected := new(bytes.Buffer)
+	assert.NoError(t, metaChangeset.Encode(expected))
+
+	stream, err := NewMetaChangesetStream(oldSha, sha, true, remote, repo, nil, nil, true, &Options{Concurrency: 2})
+	assert.NoError(t, err)
+	actual := new(bytes.Buffer)
+	assert.NoError(t, stream.Encode(actual))
+
+	assert.Equal(t, expected.String(), actual.String())
+	assert.Equal(t, metaChangeset.IdempotencyKey(), stream.IdempotencyKey())
+}
+
+func TestMakeMetaChangesetWithOversizedBinaryFile(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-metaChangeset-publisher.git"
+	repo, err := git.InitRepository(t.TempDir(), true)
+	assert.NoError(t, err)
+	first := commitFile(t, repo, "a.txt", "a\n")
+	commitFile(t, repo, "image.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x10\x00\x00\x00\x10", first)
+	oldSha := first.Id().String()
+
+	metaChangeset, err := MakeMetaChangeset("", "", true, remote, repo, nil, nil, false, &Options{MaxBlobSize: 8})
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{OldSha: oldSha, OldPath: "a.txt", NewPath: "", LineMappings: [][]int{}},
+		{OldSha: oldSha, OldPath: "", NewPath: "image.png", LineMappings: [][]int{}, Binary: true, Oversized: true},
+	}, metaChangeset.Changes)
+	assert.Equal(t, 1, metaChangeset.Files)
+	assert.Equal(t, 1, metaChangeset.OversizedFiles)
+
+	metaChangeset, err = MakeMetaChangeset("", "", true, remote, repo, nil, nil, false, &Options{MaxBlobSize: 8, ExcludeBinary: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{OldSha: oldSha, OldPath: "a.txt", NewPath: "", LineMappings: [][]int{}},
+	}, metaChangeset.Changes)
+	assert.Equal(t, 0, metaChangeset.Files)
+	assert.Equal(t, 0, metaChangeset.OversizedFiles)
+}
+
+func TestMakeMetaChangesetForMergeCommit(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-metaChangeset-publisher.git"
+	repo, err := git.InitRepository(t.TempDir(), true)
+	assert.NoError(t, err)
+	base := commitFile(t, repo, "a.txt", "a\n")
+	left := commitFiles(t, repo, map[string]string{"a.txt": "a\n", "b.txt": "b\n"}, base)
+	assert.NoError(t, repo.SetHeadDetached(base.Id()))
+	right := commitFiles(t, repo, map[string]string{"a.txt": "a\n", "c.txt": "c\n"}, base)
+	assert.NoError(t, repo.SetHeadDetached(left.Id()))
+	merge := commitFiles(t, repo, map[string]string{"a.txt": "a\n", "b.txt": "b\n", "c.txt": "c\n"}, left, right)
+
+	metaChangeset, err := MakeMetaChangeset("", "", true, remote, repo, nil, nil, false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, merge.Id().String(), metaChangeset.Sha)
+	assert.Equal(t, []string{left.Id().String(), right.Id().String()}, metaChangeset.OldShas)
+	assert.Equal(t, []Change{
+		{OldSha: left.Id().String(), OldPath: "", NewPath: "c.txt", LineMappings: [][]int{}},
+		{OldSha: right.Id().String(), OldPath: "", NewPath: "b.txt", LineMappings: [][]int{}},
+	}, metaChangeset.Changes)
+}
@@ -0,0 +1,76 @@
+package publisher
+
+import "runtime"
+
+// Options holds optional settings for MakeMetaChangeset. A nil *Options uses the defaults.
+type Options struct {
+	// The maximum number of files to compute line mappings for in parallel (default is the number of CPUs)
+	Concurrency int
+	// Where to cache computed line mappings (default is no caching)
+	Cache *LineMappingsCache
+	// Where to cache the features of trees, so they can be counted incrementally (default is no caching)
+	FeaturesCache *FeaturesCache
+	// Leave binary files out of the changes and file counts (by default they are included, without lines)
+	ExcludeBinary bool
+	// Files larger than this many bytes are not diffed or line counted (default is no limit)
+	MaxBlobSize int64
+	// Count lines and files per language, derived from file extensions
+	CountLanguages bool
+	// Overrides DefaultLanguages, mapping file extensions (e.g. ".tsx") or file names (e.g. "Makefile") to languages
+	Languages map[string]string
+	// Also count code, comment and blank lines, recognising the comment syntax of common languages
+	CountLogicalLines bool
+	// A secret key for anonymising paths (see HashPath). The key itself is never published.
+	PathKey []byte
+	// Hash each path segment on its own, so files in the same directory share a hashed prefix
+	HashPathSegments bool
+	// The number of top directory levels to keep in clear when hashing paths
+	ClearPathLevels int
+	// The number of lines of context lhdiff uses to match lines (default is 4)
+	LhdiffContextSize int
+	// Also map lines that are unchanged
+	LhdiffIncludeIdenticalLines bool
+}
+
+func (o *Options) concurrency() int {
+	if o == nil || o.Concurrency <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Concurrency
+}
+
+func (o *Options) cache() *LineMappingsCache {
+	if o == nil {
+		return nil
+	}
+	return o.Cache
+}
+
+func (o *Options) featuresCache() *FeaturesCache {
+	if o == nil {
+		return nil
+	}
+	return o.FeaturesCache
+}
+
+func (o *Options) excludeBinary() bool {
+	return o != nil && o.ExcludeBinary
+}
+
+func (o *Options) maxBlobSize() int64 {
+	if o == nil {
+		return 0
+	}
+	return o.MaxBlobSize
+}
+
+func (o *Options) lhdiffContextSize() int {
+	if o == nil || o.LhdiffContextSize <= 0 {
+		return 4
+	}
+	return o.LhdiffContextSize
+}
+
+func (o *Options) lhdiffIncludeIdenticalLines() bool {
+	return o != nil && o.LhdiffIncludeIdenticalLines
+}
@@ -0,0 +1,31 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+)
+
+// isOversized returns whether either side of a change is larger than maxBlobSize bytes.
+// Only the object headers are read, so oversized blobs are never loaded.
+func isOversized(odb *git.Odb, file git.DiffDelta, maxBlobSize int64) (bool, error) {
+	for _, diffFile := range []git.DiffFile{file.OldFile, file.NewFile} {
+		if diffFile.Flags&git.DiffFlagExists == 0 {
+			continue
+		}
+		oversized, err := blobIsOversized(odb, diffFile.Oid, maxBlobSize)
+		if err != nil || oversized {
+			return oversized, err
+		}
+	}
+	return false, nil
+}
+
+func blobIsOversized(odb *git.Odb, oid *git.Oid, maxBlobSize int64) (bool, error) {
+	if maxBlobSize <= 0 {
+		return false, nil
+	}
+	size, _, err := odb.ReadHeader(oid)
+	if err != nil {
+		return false, err
+	}
+	return size > uint64(maxBlobSize), nil
+}
@@ -0,0 +1,33 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBlobIsOversizedWithoutLimit(t *testing.T) {
+	oversized, err := blobIsOversized(nil, nil, 0)
+	assert.NoError(t, err)
+	assert.False(t, oversized)
+}
+
+func TestBlobIsOversized(t *testing.T) {
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	tree := lookupTree(t, repo, "1ae2aabbcdd11948403578a4f2dd32911cc48a00")
+	entry, err := tree.EntryByPath("testdata/a.txt")
+	assert.NoError(t, err)
+
+	odb, err := repo.Odb()
+	assert.NoError(t, err)
+	defer odb.Free()
+
+	oversized, err := blobIsOversized(odb, entry.Id, 1)
+	assert.NoError(t, err)
+	assert.True(t, oversized)
+
+	oversized, err = blobIsOversized(odb, entry.Id, 1024*1024)
+	assert.NoError(t, err)
+	assert.False(t, oversized)
+}
@@ -0,0 +1,80 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// changesetPart is one of the parts a changeset with too many changes is split into. Each part has
+// all the fields of the changeset, but only some of its changes. The parts share an upload id, and
+// are numbered from 0, so OneReport can reassemble them.
+type changesetPart struct {
+	*MetaChangeset
+	uploadId string
+	index    int
+	count    int
+}
+
+func (p *changesetPart) IdempotencyKey() string {
+	return fmt.Sprintf("%s-%d", p.uploadId, p.index)
+}
+
+func (p *changesetPart) setHeaders(header http.Header) {
+	header.Set("Upload-Id", p.uploadId)
+	header.Set("Upload-Part-Index", strconv.Itoa(p.index))
+	header.Set("Upload-Part-Count", strconv.Itoa(p.count))
+}
+
+// splitChangeset splits changeset into parts whose changes encode to at most maxPartSize bytes.
+// A single change larger than maxPartSize gets a part of its own. A changeset that fits, or that is
+// not a *MetaChangeset, is not split.
+func splitChangeset(changeset ChangesetEncoder, maxPartSize int) ([]ChangesetEncoder, error) {
+	metaChangeset, ok := changeset.(*MetaChangeset)
+	if !ok || maxPartSize <= 0 {
+		return []ChangesetEncoder{changeset}, nil
+	}
+	partsChanges, err := splitChanges(metaChangeset.Changes, maxPartSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(partsChanges) <= 1 {
+		return []ChangesetEncoder{changeset}, nil
+	}
+	parts := make([]ChangesetEncoder, len(partsChanges))
+	for i, changes := range partsChanges {
+		part := *metaChangeset
+		part.Changes = changes
+		parts[i] = &changesetPart{
+			MetaChangeset: &part,
+			uploadId:      changeset.IdempotencyKey(),
+			index:         i,
+			count:         len(partsChanges),
+		}
+	}
+	return parts, nil
+}
+
+// splitChanges splits changes into consecutive groups, each of which encodes to at most maxSize
+// bytes, except for single changes larger than maxSize.
+func splitChanges(changes []Change, maxSize int) ([][]Change, error) {
+	var groups [][]Change
+	start := 0
+	size := 0
+	for i, change := range changes {
+		encoded, err := json.Marshal(change)
+		if err != nil {
+			return nil, err
+		}
+		// The comma separating it from the previous change
+		changeSize := len(encoded) + 1
+		if i > start && size+changeSize > maxSize {
+			groups = append(groups, changes[start:i])
+			start = i
+			size = 0
+		}
+		size += changeSize
+	}
+	return append(groups, changes[start:]), nil
+}
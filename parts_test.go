@@ -0,0 +1,89 @@
+package publisher
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func changesOfSize(n int) []Change {
+	changes := make([]Change, n)
+	for i := range changes {
+		changes[i] = Change{OldSha: "aaa", OldPath: "a.txt", NewPath: "a.txt", LineMappings: [][]int{{i, i}}}
+	}
+	return changes
+}
+
+func TestSplitChanges(t *testing.T) {
+	changes := changesOfSize(5)
+	encoded, err := json.Marshal(changes[0])
+	assert.NoError(t, err)
+	changeSize := len(encoded) + 1
+
+	groups, err := splitChanges(changes, 2*changeSize)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Change{changes[0:2], changes[2:4], changes[4:5]}, groups)
+
+	groups, err = splitChanges(changes, 1)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 5)
+
+	groups, err = splitChanges(changes, 5*changeSize)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Change{changes}, groups)
+
+	groups, err = splitChanges([]Change{}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Change{{}}, groups)
+}
+
+func TestPublishInParts(t *testing.T) {
+	changeset := &MetaChangeset{Remote: "some-remote", Sha: "bbb", OldShas: []string{"aaa"}, Changes: changesOfSize(10), Loc: 9876, Files: 31}
+
+	var mu sync.Mutex
+	var reassembled []Change
+	var uploadIds []string
+	var idempotencyKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		part := &MetaChangeset{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(part))
+		assert.Equal(t, strconv.Itoa(len(uploadIds)), req.Header.Get("Upload-Part-Index"))
+		assert.Equal(t, "4", req.Header.Get("Upload-Part-Count"))
+		assert.Equal(t, 9876, part.Loc)
+		uploadIds = append(uploadIds, req.Header.Get("Upload-Id"))
+		idempotencyKeys = append(idempotencyKeys, req.Header.Get("Idempotency-Key"))
+		reassembled = append(reassembled, part.Changes...)
+		_, _ = res.Write([]byte("part " + req.Header.Get("Upload-Part-Index")))
+	}))
+	defer server.Close()
+
+	encoded, err := json.Marshal(changeset.Changes[0])
+	assert.NoError(t, err)
+	txt, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{MaxPartSize: 3 * (len(encoded) + 1)})
+	assert.NoError(t, err)
+	assert.Equal(t, "part 3", txt)
+
+	assert.Equal(t, changeset.Changes, reassembled)
+	key := changeset.IdempotencyKey()
+	assert.Equal(t, []string{key, key, key, key}, uploadIds)
+	assert.Equal(t, []string{key + "-0", key + "-1", key + "-2", key + "-3"}, idempotencyKeys)
+}
+
+func TestPublishWithoutParts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("Upload-Id"))
+		_, _ = res.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	changeset := &MetaChangeset{Changes: changesOfSize(3)}
+	txt, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{MaxPartSize: 1 << 20})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+}
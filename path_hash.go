@@ -0,0 +1,48 @@
+package publisher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// HashPath anonymises a file path. With Options.PathKey it is an HMAC-SHA256 of the path, which is
+// stable for everyone holding the key, but cannot be reversed by hashing a dictionary of common paths.
+// Without a key it is a plain SHA-1 of the path.
+//
+// By default the whole path is hashed. Options.ClearPathLevels keeps the top directory levels in clear,
+// and Options.HashPathSegments hashes each of the remaining segments on its own, so files in the
+// same directory share a hashed prefix.
+func (o *Options) HashPath(path string) string {
+	if o == nil || (!o.HashPathSegments && o.ClearPathLevels <= 0) {
+		return o.hash(path)
+	}
+	segments := strings.Split(path, "/")
+	// The file name is never kept in clear
+	clearLevels := o.ClearPathLevels
+	if clearLevels > len(segments)-1 {
+		clearLevels = len(segments) - 1
+	}
+	if clearLevels < 0 {
+		clearLevels = 0
+	}
+	hashed := append([]string{}, segments[:clearLevels]...)
+	if o.HashPathSegments {
+		for _, segment := range segments[clearLevels:] {
+			hashed = append(hashed, o.hash(segment))
+		}
+	} else {
+		hashed = append(hashed, o.hash(strings.Join(segments[clearLevels:], "/")))
+	}
+	return strings.Join(hashed, "/")
+}
+
+func (o *Options) hash(s string) string {
+	if o == nil || len(o.PathKey) == 0 {
+		return hashString(s)
+	}
+	h := hmac.New(sha256.New, o.PathKey)
+	h.Write([]byte(s))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
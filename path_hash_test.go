@@ -0,0 +1,48 @@
+package publisher
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestHashPathWithoutKey(t *testing.T) {
+	var options *Options
+	assert.Equal(t, "858458ace7ba8e65ef6427310bd96db9cbacc26d", options.HashPath("testdata/b.txt"))
+	assert.Equal(t, "858458ace7ba8e65ef6427310bd96db9cbacc26d", (&Options{}).HashPath("testdata/b.txt"))
+}
+
+func TestHashPathWithKey(t *testing.T) {
+	options := &Options{PathKey: []byte("org-secret")}
+	assert.Equal(t, "20dfa2c20ac2a6fdb748a1c7bbc6fad6ce1c6ef34da6831ab0cf252a536ee93e", options.HashPath("testdata/b.txt"))
+
+	other := &Options{PathKey: []byte("other-secret")}
+	assert.Equal(t, "a3eb3615c33667bbbdc0e367ff1d1a6a76a020e2ac65c947cb7c725c4167f301", other.HashPath("testdata/b.txt"))
+}
+
+func TestHashPathSegments(t *testing.T) {
+	options := &Options{HashPathSegments: true}
+	assert.Equal(t, "44115646e09ab3481adc2b1dc17be10dd9cdaa09/aceba96ffdf13ce4cd4171c0248420cc03108ef0", options.HashPath("testdata/b.txt"))
+	assert.Equal(t, "44115646e09ab3481adc2b1dc17be10dd9cdaa09/fe4c80bb098894b4d6ca36c16082d567bfd41b8b", options.HashPath("testdata/c.txt"))
+}
+
+func TestHashPathWithClearLevels(t *testing.T) {
+	options := &Options{ClearPathLevels: 1}
+	assert.Equal(t, "testdata/aceba96ffdf13ce4cd4171c0248420cc03108ef0", options.HashPath("testdata/b.txt"))
+	assert.Equal(t, "a/3ec69c85a4ff96830024afeef2d4e512181c8f7b", options.HashPath("a/a/b"))
+	// The file name is never kept in clear
+	assert.Equal(t, "0607f785dfa3c3861b3239f6723eb276d8056461", options.HashPath("main.go"))
+
+	options = &Options{ClearPathLevels: 5, HashPathSegments: true}
+	assert.Equal(t, "cmd/0607f785dfa3c3861b3239f6723eb276d8056461", options.HashPath("cmd/main.go"))
+}
+
+func TestHashPathSegmentsWithKey(t *testing.T) {
+	options := &Options{HashPathSegments: true, PathKey: []byte("org-secret")}
+	b := strings.Split(options.HashPath("testdata/b.txt"), "/")
+	c := strings.Split(options.HashPath("testdata/c.txt"), "/")
+	assert.Len(t, b, 2)
+	assert.Equal(t, b[0], c[0])
+	assert.NotEqual(t, b[1], c[1])
+	assert.Equal(t, options.HashPath("b.txt"), b[1])
+}
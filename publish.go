@@ -2,30 +2,96 @@ package publisher
 
 import (
 	"bytes"
-	"encoding/json"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
-func Publish(changeset *MetaChangeset, organizationId string, baseUrl string, username string, password string) (string, error) {
-	req, err := MakeRequest(changeset, organizationId, baseUrl, username, password)
+// Publish posts the changeset to OneReport, authenticated by authenticator (none if nil).
+// The changeset is streamed to OneReport as it is encoded. A changeset other than a *MetaChangeset,
+// such as a *MetaChangesetStream, is also saved to a temporary file as it is encoded, so that
+// retries and the queue replay the file instead of encoding it again.
+// If OneReport responds with 401 Unauthorized and authenticator is a Refresher, its credentials are
+// refreshed and the request is sent again. Network errors, 408, 429 and 5xx responses are retried
+// according to options, but errors encoding the changeset are not.
+//
+// A *MetaChangeset whose changes are larger than PublishOptions.MaxPartSize is posted in parts, one
+// after the other, with Upload-Id, Upload-Part-Index and Upload-Part-Count headers. Publish then
+// returns the response to the last part.
+//
+// If the changeset cannot be published because of a network error or a 408, 429 or 5xx response,
+// either from OneReport or from the authenticator's token endpoint, and PublishOptions.Queue is set,
+// it is saved in the queue and the returned error wraps ErrQueued. Other errors, such as a changeset
+// that OneReport rejects or credentials it refuses, are returned unchanged.
+func Publish(changeset ChangesetEncoder, organizationId string, baseUrl string, authenticator Authenticator, options *PublishOptions) (string, error) {
+	if _, ok := changeset.(*MetaChangeset); !ok {
+		spool := &spooledChangeset{changeset: changeset}
+		defer spool.Close()
+		changeset = spool
+	}
+	txt, err := publishParts(changeset, organizationId, baseUrl, authenticator, options)
+	if err != nil && options.queue() != nil && errors.As(err, new(transientError)) {
+		file, queueErr := options.queue().Enqueue(changeset)
+		if queueErr != nil {
+			return "", fmt.Errorf("%v, and could not be queued: %w", err, queueErr)
+		}
+		return "", fmt.Errorf("%w in %s: %v", ErrQueued, file, err)
+	}
+	return txt, err
+}
+
+func publishParts(changeset ChangesetEncoder, organizationId string, baseUrl string, authenticator Authenticator, options *PublishOptions) (string, error) {
+	parts, err := splitChangeset(changeset, options.maxPartSize())
 	if err != nil {
 		return "", err
 	}
-	res, err := http.DefaultClient.Do(req)
+	var txt string
+	for _, part := range parts {
+		txt, err = publish(part, organizationId, baseUrl, authenticator, options)
+		if err != nil {
+			return "", err
+		}
+	}
+	return txt, nil
+}
+
+func publish(changeset ChangesetEncoder, organizationId string, baseUrl string, authenticator Authenticator, options *PublishOptions) (string, error) {
+	res, err := send(changeset, organizationId, baseUrl, authenticator, options)
 	if err != nil {
 		return "", err
 	}
+	if refresher, ok := authenticator.(Refresher); ok && res.StatusCode == http.StatusUnauthorized {
+		_ = res.Body.Close()
+		err = refresher.Refresh()
+		if err != nil {
+			return "", err
+		}
+		res, err = send(changeset, organizationId, baseUrl, authenticator, options)
+		if err != nil {
+			return "", err
+		}
+	}
+	defer res.Body.Close()
 	if res.StatusCode >= 400 {
 		txt, err := httputil.DumpResponse(res, true)
 		if err != nil {
 			return "", err
 		}
 		cleaned := strings.ReplaceAll(string(txt), "\r\n", "\n")
-		return "", fmt.Errorf("HTTP request failed:\n\n%s", cleaned)
+		err = fmt.Errorf("HTTP request failed:\n\n%s", cleaned)
+		if retryable(res, nil) {
+			err = transientError{err}
+		} else if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnprocessableEntity {
+			err = rejectedError{err}
+		}
+		return "", err
 	}
 	buf := new(bytes.Buffer)
 	_, err = buf.ReadFrom(res.Body)
@@ -35,21 +101,143 @@ func Publish(changeset *MetaChangeset, organizationId string, baseUrl string, us
 	return buf.String(), nil
 }
 
-func MakeRequest(changeset *MetaChangeset, organizationId string, baseUrl string, username string, password string) (*http.Request, error) {
-	body, err := json.MarshalIndent(changeset, "", "  ")
-	if err != nil {
-		return nil, err
+// send sends the request, retrying it after network errors, 408, 429 and 5xx responses.
+func send(changeset ChangesetEncoder, organizationId string, baseUrl string, authenticator Authenticator, options *PublishOptions) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := MakeRequest(changeset, organizationId, baseUrl, authenticator, options)
+		if err != nil {
+			return nil, err
+		}
+		res, err := options.client().Do(req)
+		if attempt >= options.retries() || !retryable(res, err) {
+			if err != nil && retryable(res, err) {
+				err = transientError{err}
+			}
+			return res, err
+		}
+		delay := backoff(attempt, res, options)
+		if res != nil {
+			_ = res.Body.Close()
+		}
+		time.Sleep(delay)
 	}
+}
+
+// MakeRequest makes the request that Publish sends. The changeset is posted as compact JSON,
+// compressed according to options, and encoded into the body through a pipe as the body is read.
+func MakeRequest(changeset ChangesetEncoder, organizationId string, baseUrl string, authenticator Authenticator, options *PublishOptions) (*http.Request, error) {
 	u, err := url.Parse(baseUrl)
 	if err != nil {
 		return nil, err
 	}
 	u.Path = "/api/organization/" + url.PathEscape(organizationId) + "/changeset"
-	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewBuffer(body))
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/vnd.smartbear.onereport.changeset.v1+json")
-	req.SetBasicAuth(username, password)
+	if options.compression() != NoCompression {
+		req.Header.Set("Content-Encoding", string(options.compression()))
+	}
+	req.Header.Set("Idempotency-Key", changeset.IdempotencyKey())
+	if part, ok := changeset.(*changesetPart); ok {
+		part.setHeaders(req.Header)
+	}
+	if authenticator != nil {
+		err = authenticator.Authenticate(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Body = &encodedBody{changeset: changeset, compression: options.compression()}
 	return req, nil
 }
+
+// transientError is an error publishing a changeset that may not happen again later: a network
+// error, or a 408, 429 or 5xx response.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e transientError) Unwrap() error {
+	return e.err
+}
+
+// rejectedError is a 400 or 422 response, where OneReport rejects the changeset itself, so that
+// posting it again would fail again.
+type rejectedError struct {
+	err error
+}
+
+func (e rejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e rejectedError) Unwrap() error {
+	return e.err
+}
+
+// encodeError is an error encoding a changeset into a request body, as opposed to sending it.
+type encodeError struct {
+	err error
+}
+
+func (e encodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e encodeError) Unwrap() error {
+	return e.err
+}
+
+// encodedBody is a request body of the compressed changeset, which is encoded through a pipe as it
+// is read. The encoding starts on the first read, and closing the body before the end stops it.
+type encodedBody struct {
+	changeset   ChangesetEncoder
+	compression Compression
+	once        sync.Once
+	r           *io.PipeReader
+}
+
+func (b *encodedBody) Read(p []byte) (int, error) {
+	b.once.Do(b.start)
+	return b.r.Read(p)
+}
+
+func (b *encodedBody) Close() error {
+	b.once.Do(func() {
+		b.r, _ = io.Pipe()
+	})
+	return b.r.Close()
+}
+
+func (b *encodedBody) start() {
+	r, w := io.Pipe()
+	b.r = r
+	go func() {
+		compressor, err := newCompressor(w, b.compression)
+		if err == nil {
+			err = b.changeset.Encode(compressor)
+		}
+		if err == nil {
+			err = compressor.Close()
+		}
+		if err != nil {
+			_ = w.CloseWithError(encodeError{err})
+			return
+		}
+		_ = w.Close()
+	}()
+}
+
+// IdempotencyKey identifies a changeset by its remote and sha, so OneReport can recognise a retried
+// post of a changeset it already received, and not create a duplicate.
+func IdempotencyKey(changeset *MetaChangeset) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%s", changeset.Remote, changeset.Sha)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
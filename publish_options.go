@@ -0,0 +1,77 @@
+package publisher
+
+import (
+	"net/http"
+	"time"
+)
+
+// PublishOptions holds optional settings for Publish. A nil *PublishOptions uses the defaults.
+type PublishOptions struct {
+	// The client used to send requests (default is http.DefaultClient). See NewHTTPClient. A
+	// Client.Timeout also limits the time taken to encode a streamed changeset, so prefer a
+	// Transport.ResponseHeaderTimeout.
+	Client *http.Client
+	// The number of times to retry after a network error, 408 Request Timeout, 429 Too Many Requests or 5xx response (default is no retries)
+	Retries int
+	// The delay before the first retry, doubled for each further retry (default is 1s)
+	InitialBackoff time.Duration
+	// The maximum delay between retries, including one requested by Retry-After (default is 30s)
+	MaxBackoff time.Duration
+	// How to compress the posted changesets (default is no compression)
+	Compression Compression
+	// The maximum size in bytes of the encoded changes posted in one request, before compression. A
+	// *MetaChangeset with larger changes is posted in parts (default is no limit).
+	MaxPartSize int
+	// Where to save changesets that cannot be published because of a network error or a 408, 429 or
+	// 5xx response, to publish them later with Queue.Flush (default is not to save them)
+	Queue *Queue
+}
+
+func (o *PublishOptions) client() *http.Client {
+	if o == nil || o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+func (o *PublishOptions) retries() int {
+	if o == nil || o.Retries < 0 {
+		return 0
+	}
+	return o.Retries
+}
+
+func (o *PublishOptions) initialBackoff() time.Duration {
+	if o == nil || o.InitialBackoff <= 0 {
+		return time.Second
+	}
+	return o.InitialBackoff
+}
+
+func (o *PublishOptions) maxBackoff() time.Duration {
+	if o == nil || o.MaxBackoff <= 0 {
+		return 30 * time.Second
+	}
+	return o.MaxBackoff
+}
+
+func (o *PublishOptions) compression() Compression {
+	if o == nil {
+		return NoCompression
+	}
+	return o.Compression
+}
+
+func (o *PublishOptions) maxPartSize() int {
+	if o == nil {
+		return 0
+	}
+	return o.MaxPartSize
+}
+
+func (o *PublishOptions) queue() *Queue {
+	if o == nil {
+		return nil
+	}
+	return o.Queue
+}
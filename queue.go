@@ -0,0 +1,153 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrQueued is wrapped by the error Publish returns when a changeset could not be published, but
+// was saved in PublishOptions.Queue to be published later.
+var ErrQueued = errors.New("changeset queued")
+
+// Queue is a spool directory of changesets that could not be published. Each changeset is saved in a
+// file named <unixTime>-<sha>.json, so that the files sort in commit order.
+type Queue struct {
+	dir string
+}
+
+// NewQueue returns a queue that saves changesets in dir.
+func NewQueue(dir string) *Queue {
+	return &Queue{dir: dir}
+}
+
+// Enqueue saves the changeset in the queue, and returns the file it is saved in. Enqueuing the same
+// changeset again replaces the file.
+func (q *Queue) Enqueue(changeset ChangesetEncoder) (string, error) {
+	header, ok := changesetHeader(changeset)
+	if !ok {
+		return "", fmt.Errorf("cannot queue a %T", changeset)
+	}
+	err := os.MkdirAll(q.dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%012d-%s.json", header.UnixTime, header.Sha)
+	path := filepath.Join(q.dir, name)
+	// Write to a temporary file first, so a flush never reads a partial changeset
+	tmp, err := os.CreateTemp(q.dir, name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	err = changeset.Encode(tmp)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// Files returns the files of the queued changesets, oldest commit first.
+func (q *Queue) Files() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, filepath.Join(q.dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Flush publishes the queued changesets, oldest commit first, and deletes each one after it is
+// published. A changeset file that cannot be read, or that OneReport rejects with a 400 or 422
+// response, would never be published, so it is moved to the failed subdirectory of the queue, and the
+// others are still published. Flush stops at any other error, such as a network error, a 5xx response
+// or credentials that OneReport or the token endpoint refuses, and leaves the rest of the queue to be
+// published in order later. Flush returns the number of changesets it published.
+func (q *Queue) Flush(organizationId string, baseUrl string, authenticator Authenticator, options *PublishOptions) (int, error) {
+	files, err := q.Files()
+	if err != nil {
+		return 0, err
+	}
+	// Do not queue the changesets again
+	var flushOptions PublishOptions
+	if options != nil {
+		flushOptions = *options
+	}
+	flushOptions.Queue = nil
+
+	published := 0
+	var failures []string
+	for _, file := range files {
+		changeset, err := ReadMetaChangesetFile(file)
+		if err == nil {
+			_, err = Publish(changeset, organizationId, baseUrl, authenticator, &flushOptions)
+			if err != nil && !errors.As(err, new(rejectedError)) {
+				return published, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		if err != nil {
+			failedFile, moveErr := q.fail(file)
+			if moveErr != nil {
+				return published, moveErr
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", failedFile, err))
+			continue
+		}
+		err = os.Remove(file)
+		if err != nil {
+			return published, err
+		}
+		published++
+	}
+	if len(failures) > 0 {
+		return published, fmt.Errorf("%d queued changesets could not be published and were moved to %s:\n%s", len(failures), q.failedDir(), strings.Join(failures, "\n"))
+	}
+	return published, nil
+}
+
+// failedDir is where changesets that cannot be published are moved to.
+func (q *Queue) failedDir() string {
+	return filepath.Join(q.dir, "failed")
+}
+
+// fail moves a queued changeset file to failedDir, and returns its new path.
+func (q *Queue) fail(file string) (string, error) {
+	err := os.MkdirAll(q.failedDir(), 0755)
+	if err != nil {
+		return "", err
+	}
+	failedFile := filepath.Join(q.failedDir(), filepath.Base(file))
+	return failedFile, os.Rename(file, failedFile)
+}
+
+// changesetHeader returns the changeset's fields other than its changes and features.
+func changesetHeader(changeset ChangesetEncoder) (*MetaChangeset, bool) {
+	switch c := changeset.(type) {
+	case *MetaChangeset:
+		return c, true
+	case *MetaChangesetStream:
+		return &c.header, true
+	case *changesetPart:
+		return c.MetaChangeset, true
+	case *spooledChangeset:
+		return c.header()
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,216 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestPublishQueuesChangesetOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	queue := NewQueue(t.TempDir())
+
+	changeset := &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}}
+	_, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Queue: queue})
+	assert.True(t, errors.Is(err, ErrQueued))
+
+	files, err := queue.Files()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(queue.dir, "001644410531-1ae2aabbcdd11948403578a4f2dd32911cc48a00.json")}, files)
+}
+
+func TestPublishQueuesChangesetOnNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	queue := NewQueue(t.TempDir())
+
+	changeset := &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}}
+	_, err := Publish(changeset, "org", url, nil, &PublishOptions{Queue: queue})
+	assert.True(t, errors.Is(err, ErrQueued))
+
+	files, err := queue.Files()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestPublishQueuesChangesetWhenTokenEndpointIsDown(t *testing.T) {
+	tokenServer := httptest.NewServer(http.NotFoundHandler())
+	tokenServer.Close()
+	authenticator := &ClientCredentials{TokenURL: tokenServer.URL, ClientID: "ci", ClientSecret: "secret"}
+	queue := NewQueue(t.TempDir())
+
+	changeset := &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}}
+	_, err := Publish(changeset, "org", "http://localhost", authenticator, &PublishOptions{Queue: queue})
+	assert.True(t, errors.Is(err, ErrQueued))
+
+	files, err := queue.Files()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestPublishDoesNotQueueRejectedChangeset(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity} {
+		server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(status)
+		}))
+		queue := NewQueue(t.TempDir())
+
+		changeset := &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}}
+		_, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Queue: queue})
+		server.Close()
+		if assert.Error(t, err) {
+			assert.False(t, errors.Is(err, ErrQueued))
+			assert.Contains(t, err.Error(), http.StatusText(status))
+		}
+
+		files, err := queue.Files()
+		assert.NoError(t, err)
+		assert.Empty(t, files)
+	}
+}
+
+func TestFlushPublishesInCommitOrder(t *testing.T) {
+	var mu sync.Mutex
+	var published []string
+	available := false
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !available {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		changeset := &MetaChangeset{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(changeset))
+		published = append(published, changeset.Sha)
+	}))
+	defer server.Close()
+	queue := NewQueue(t.TempDir())
+	options := &PublishOptions{Queue: queue}
+
+	for _, changeset := range []*MetaChangeset{
+		{Remote: "some-remote", UnixTime: 1644410600, OldShas: []string{}, Sha: "ad2c70149ccc529ab26588cde2af1312e6aa0c06", Changes: []Change{}},
+		{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}},
+		{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}},
+		{Remote: "some-remote", UnixTime: 999999999, OldShas: []string{}, Sha: "e57bfde5c3591a14c0e199c900174a08b0b94312", Changes: []Change{}},
+	} {
+		_, err := Publish(changeset, "org", server.URL, nil, options)
+		assert.True(t, errors.Is(err, ErrQueued))
+	}
+
+	n, err := queue.Flush("org", server.URL, nil, options)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+
+	mu.Lock()
+	available = true
+	mu.Unlock()
+	n, err = queue.Flush("org", server.URL, nil, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"e57bfde5c3591a14c0e199c900174a08b0b94312", "1ae2aabbcdd11948403578a4f2dd32911cc48a00", "ad2c70149ccc529ab26588cde2af1312e6aa0c06"}, published)
+
+	files, err := queue.Files()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestFlushMovesRejectedChangesetsToFailed(t *testing.T) {
+	rejectedSha := "1ae2aabbcdd11948403578a4f2dd32911cc48a00"
+	var mu sync.Mutex
+	var published []string
+	available := false
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !available {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		changeset := &MetaChangeset{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(changeset))
+		if changeset.Sha == rejectedSha {
+			res.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		published = append(published, changeset.Sha)
+	}))
+	defer server.Close()
+	queue := NewQueue(t.TempDir())
+	options := &PublishOptions{Queue: queue}
+
+	for _, changeset := range []*MetaChangeset{
+		{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: rejectedSha, Changes: []Change{}},
+		{Remote: "some-remote", UnixTime: 1644410600, OldShas: []string{}, Sha: "ad2c70149ccc529ab26588cde2af1312e6aa0c06", Changes: []Change{}},
+	} {
+		_, err := Publish(changeset, "org", server.URL, nil, options)
+		assert.True(t, errors.Is(err, ErrQueued))
+	}
+
+	mu.Lock()
+	available = true
+	mu.Unlock()
+	n, err := queue.Flush("org", server.URL, nil, options)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "422 Unprocessable Entity")
+	}
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"ad2c70149ccc529ab26588cde2af1312e6aa0c06"}, published)
+
+	files, err := queue.Files()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.FileExists(t, filepath.Join(queue.dir, "failed", "001644410531-"+rejectedSha+".json"))
+}
+
+func TestFlushStopsWhenAuthenticationFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token-1" {
+			res.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = res.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	tokenServer, _ := newTokenServer(t, 3600)
+	queue := NewQueue(t.TempDir())
+
+	for _, changeset := range []*MetaChangeset{
+		{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}},
+		{Remote: "some-remote", UnixTime: 1644410600, OldShas: []string{}, Sha: "ad2c70149ccc529ab26588cde2af1312e6aa0c06", Changes: []Change{}},
+	} {
+		_, err := queue.Enqueue(changeset)
+		assert.NoError(t, err)
+	}
+	queued, err := queue.Files()
+	assert.NoError(t, err)
+
+	for _, authenticator := range []Authenticator{
+		&ClientCredentials{TokenURL: tokenServer.URL, ClientID: "ci", ClientSecret: "wrong"},
+		&BearerToken{Token: "expired"},
+	} {
+		n, err := queue.Flush("org", server.URL, authenticator, nil)
+		assert.Error(t, err)
+		assert.Equal(t, 0, n)
+
+		files, err := queue.Files()
+		assert.NoError(t, err)
+		assert.Equal(t, queued, files)
+		assert.NoDirExists(t, filepath.Join(queue.dir, "failed"))
+	}
+}
+
+func TestFilesOfMissingQueue(t *testing.T) {
+	files, err := NewQueue(filepath.Join(t.TempDir(), "queue")).Files()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,78 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/sabhiram/go-gitignore"
+)
+
+// MakeMetaChangesets walks the commits in revisionRange (e.g. A..B), oldest first, and calls
+// callback with a MetaChangeset for each commit. Each MetaChangeset is computed against the
+// commit's own parents.
+func MakeMetaChangesets(
+	revisionRange string,
+	usePaths bool,
+	remote string,
+	repo *git.Repository,
+	exclude *ignore.GitIgnore,
+	include *ignore.GitIgnore,
+	includeLines bool,
+	options *Options,
+	callback func(*MetaChangeset) error,
+) error {
+	walk, err := repo.Walk()
+	if err != nil {
+		return err
+	}
+	defer walk.Free()
+
+	walk.Sorting(git.SortTopological | git.SortReverse)
+	err = walk.PushRange(revisionRange)
+	if err != nil {
+		return err
+	}
+
+	return walkMetaChangesets(walk, usePaths, remote, repo, exclude, include, includeLines, options, func(commit *git.Commit) bool {
+		return true
+	}, callback)
+}
+
+func walkMetaChangesets(
+	walk *git.RevWalk,
+	usePaths bool,
+	remote string,
+	repo *git.Repository,
+	exclude *ignore.GitIgnore,
+	include *ignore.GitIgnore,
+	includeLines bool,
+	options *Options,
+	filter func(*git.Commit) bool,
+	callback func(*MetaChangeset) error,
+) error {
+	oid := new(git.Oid)
+	for {
+		err := walk.Next(oid)
+		if git.IsErrorCode(err, git.ErrorCodeIterOver) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		commit, err := repo.LookupCommit(oid)
+		if err != nil {
+			return err
+		}
+		if !filter(commit) {
+			continue
+		}
+
+		changeset, err := MakeMetaChangeset("", oid.String(), usePaths, remote, repo, exclude, include, includeLines, options)
+		if err != nil {
+			return err
+		}
+		err = callback(changeset)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMakeMetaChangesets(t *testing.T) {
+	remote := "git@github.com:SmartBear/one-report-changeset-publisher.git"
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+
+	var shas []string
+	var oldShas [][]string
+	err = MakeMetaChangesets(
+		"ad2c70149ccc529ab26588cde2af1312e6aa0c06..082022d1a8bac6a768b0fc9243f3f37ede8c0fc3",
+		true,
+		remote,
+		repo,
+		nil,
+		nil,
+		false,
+		nil,
+		func(changeset *MetaChangeset) error {
+			shas = append(shas, changeset.Sha)
+			oldShas = append(oldShas, changeset.OldShas)
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"1ae2aabbcdd11948403578a4f2dd32911cc48a00",
+		"e57bfde5c3591a14c0e199c900174a08b0b94312",
+		"082022d1a8bac6a768b0fc9243f3f37ede8c0fc3",
+	}, shas)
+	assert.Equal(t, [][]string{
+		{"ad2c70149ccc529ab26588cde2af1312e6aa0c06"},
+		{"1ae2aabbcdd11948403578a4f2dd32911cc48a00"},
+		{"e57bfde5c3591a14c0e199c900174a08b0b94312"},
+	}, oldShas)
+}
@@ -0,0 +1,39 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"sort"
+	"strings"
+)
+
+// PathHashes maps the hashed path (see Options.HashPath) of every file and directory in tree to
+// its path. It only uses the local repository, so paths never leave the machine.
+func PathHashes(tree *git.Tree, options *Options) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := tree.Walk(func(name string, entry *git.TreeEntry) error {
+		path := strings.Join([]string{name, entry.Name}, "")
+		hashes[options.HashPath(path)] = path
+		return nil
+	})
+	return hashes, err
+}
+
+// ResolvePathHashes replaces every hashed path in text that is a key in hashes with its path.
+// Longer hashed paths take precedence, so a file's hashed path is not mistaken for its directory's.
+func ResolvePathHashes(text string, hashes map[string]string) string {
+	hashedPaths := make([]string, 0, len(hashes))
+	for hashedPath := range hashes {
+		hashedPaths = append(hashedPaths, hashedPath)
+	}
+	sort.Slice(hashedPaths, func(i, j int) bool {
+		if len(hashedPaths[i]) != len(hashedPaths[j]) {
+			return len(hashedPaths[i]) > len(hashedPaths[j])
+		}
+		return hashedPaths[i] < hashedPaths[j]
+	})
+	oldNew := make([]string, 0, 2*len(hashedPaths))
+	for _, hashedPath := range hashedPaths {
+		oldNew = append(oldNew, hashedPath, hashes[hashedPath])
+	}
+	return strings.NewReplacer(oldNew...).Replace(text)
+}
@@ -0,0 +1,42 @@
+package publisher
+
+import (
+	"github.com/libgit2/git2go/v33"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPathHashes(t *testing.T) {
+	repo, err := git.OpenRepository(".")
+	assert.NoError(t, err)
+	tree := lookupTree(t, repo, "082022d1a8bac6a768b0fc9243f3f37ede8c0fc3")
+
+	hashes, err := PathHashes(tree, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata/c.txt", hashes["d45df6aad2a7e9dc7ff0309d1a916f0d75dcad7a"])
+
+	hashes, err = PathHashes(tree, &Options{HashPathSegments: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata", hashes["44115646e09ab3481adc2b1dc17be10dd9cdaa09"])
+	assert.Equal(t, "testdata/c.txt", hashes["44115646e09ab3481adc2b1dc17be10dd9cdaa09/fe4c80bb098894b4d6ca36c16082d567bfd41b8b"])
+}
+
+func TestResolvePathHashes(t *testing.T) {
+	hashes := map[string]string{
+		"858458ace7ba8e65ef6427310bd96db9cbacc26d":                                          "testdata/b.txt",
+		"44115646e09ab3481adc2b1dc17be10dd9cdaa09":                                          "testdata",
+		"44115646e09ab3481adc2b1dc17be10dd9cdaa09/fe4c80bb098894b4d6ca36c16082d567bfd41b8b": "testdata/c.txt",
+	}
+	export := `[
+  {"path": "858458ace7ba8e65ef6427310bd96db9cbacc26d", "impact": 3},
+  {"path": "44115646e09ab3481adc2b1dc17be10dd9cdaa09/fe4c80bb098894b4d6ca36c16082d567bfd41b8b", "impact": 2},
+  {"path": "44115646e09ab3481adc2b1dc17be10dd9cdaa09", "impact": 1},
+  {"path": "0000000000000000000000000000000000000000", "impact": 0}
+]`
+	assert.Equal(t, `[
+  {"path": "testdata/b.txt", "impact": 3},
+  {"path": "testdata/c.txt", "impact": 2},
+  {"path": "testdata", "impact": 1},
+  {"path": "0000000000000000000000000000000000000000", "impact": 0}
+]`, ResolvePathHashes(export, hashes))
+}
@@ -0,0 +1,63 @@
+package publisher
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryable returns whether a request that failed with err, or got res, is worth retrying.
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		// The changeset could not be encoded, which would fail again
+		return !errors.As(err, new(encodeError))
+	}
+	return res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// backoff returns the delay before retry number attempt (0 for the first retry). It is the delay
+// requested by a Retry-After header if there is one, or else an exponential backoff with jitter.
+// Either way, it is at most options.maxBackoff().
+func backoff(attempt int, res *http.Response, options *PublishOptions) time.Duration {
+	max := options.maxBackoff()
+	if delay, ok := retryAfter(res, time.Now()); ok {
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+	delay := options.initialBackoff()
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	// Equal jitter: half the delay, plus a random part of the other half
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date.
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
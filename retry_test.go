@@ -0,0 +1,151 @@
+package publisher
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer returns a server that responds with statuses in turn, and then 200 OK.
+// It also returns the Idempotency-Key of each request it received.
+func newFlakyServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var idempotencyKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		idempotencyKeys = append(idempotencyKeys, req.Header.Get("Idempotency-Key"))
+		if len(idempotencyKeys) <= len(statuses) {
+			for name, values := range header {
+				res.Header()[name] = values
+			}
+			res.WriteHeader(statuses[len(idempotencyKeys)-1])
+			return
+		}
+		_, _ = res.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return idempotencyKeys
+	}
+}
+
+func TestPublishRetriesServerErrors(t *testing.T) {
+	server, idempotencyKeys := newFlakyServer(t, nil, http.StatusServiceUnavailable, http.StatusBadGateway)
+	changeset := &MetaChangeset{Remote: "some-remote", Sha: "bbb"}
+
+	txt, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Retries: 2, InitialBackoff: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+	key := IdempotencyKey(changeset)
+	assert.Equal(t, []string{key, key, key}, idempotencyKeys())
+}
+
+func TestPublishRetriesTooManyRequests(t *testing.T) {
+	server, idempotencyKeys := newFlakyServer(t, http.Header{"Retry-After": {"0"}}, http.StatusTooManyRequests)
+
+	txt, err := Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Retries: 1, InitialBackoff: time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+	assert.Len(t, idempotencyKeys(), 2)
+}
+
+func TestPublishGivesUpAfterRetries(t *testing.T) {
+	server, idempotencyKeys := newFlakyServer(t, nil, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+
+	_, err := Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Retries: 2, InitialBackoff: time.Millisecond})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "500 Internal Server Error")
+	}
+	assert.Len(t, idempotencyKeys(), 3)
+}
+
+func TestPublishDoesNotRetryClientErrors(t *testing.T) {
+	server, idempotencyKeys := newFlakyServer(t, nil, http.StatusBadRequest)
+
+	_, err := Publish(&MetaChangeset{}, "org", server.URL, nil, &PublishOptions{Retries: 2, InitialBackoff: time.Millisecond})
+	assert.Error(t, err)
+	assert.Len(t, idempotencyKeys(), 1)
+}
+
+func TestPublishRetriesNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	start := time.Now()
+	_, err := Publish(&MetaChangeset{}, "org", url, nil, &PublishOptions{Retries: 2, InitialBackoff: 20 * time.Millisecond})
+	assert.Error(t, err)
+	// Backoffs of at least 10ms and 20ms, with jitter
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(30*time.Millisecond))
+}
+
+// failingEncoder is a changeset that writes part of its body and then fails.
+type failingEncoder struct {
+	encodes int32
+}
+
+func (e *failingEncoder) IdempotencyKey() string {
+	return "failing"
+}
+
+func (e *failingEncoder) Encode(w io.Writer) error {
+	atomic.AddInt32(&e.encodes, 1)
+	_, _ = w.Write([]byte(`{"remote":`))
+	return errors.New("diff failed")
+}
+
+func TestPublishDoesNotRetryEncodeErrors(t *testing.T) {
+	server, _ := newFlakyServer(t, nil)
+	changeset := &failingEncoder{}
+
+	_, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Retries: 2, InitialBackoff: time.Millisecond})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "diff failed")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&changeset.encodes))
+}
+
+func TestMakeRequestEncodesOnRead(t *testing.T) {
+	changeset := &failingEncoder{}
+	req, err := MakeRequest(changeset, "org", "https://host.com", nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, req.Body.Close())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&changeset.encodes))
+}
+
+func TestBackoff(t *testing.T) {
+	options := &PublishOptions{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		delay := backoff(attempt, nil, options)
+		assert.GreaterOrEqual(t, int64(delay), int64(max/2))
+		assert.LessOrEqual(t, int64(delay), int64(max))
+	}
+
+	res := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	assert.Equal(t, 3*time.Second, backoff(0, res, options))
+	res = &http.Response{Header: http.Header{"Retry-After": {"120"}}}
+	assert.Equal(t, 10*time.Second, backoff(0, res, options))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := retryAfter(&http.Response{Header: http.Header{"Retry-After": {"Wed, 09 Feb 2022 12:00:05 GMT"}}}, now)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+
+	_, ok = retryAfter(&http.Response{Header: http.Header{"Retry-After": {"soon"}}}, now)
+	assert.False(t, ok)
+
+	_, ok = retryAfter(&http.Response{Header: http.Header{}}, now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,120 @@
+package publisher
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// spooledChangeset encodes a changeset once, and saves the encoding in a temporary file at the same
+// time. Later encodes copy the file, so that retrying or queuing a *MetaChangesetStream does not
+// compute its changes and line mappings again.
+type spooledChangeset struct {
+	changeset ChangesetEncoder
+	mu        sync.Mutex
+	// The complete encoding of the changeset, nil until it has been encoded
+	file *os.File
+}
+
+func (s *spooledChangeset) IdempotencyKey() string {
+	return s.changeset.IdempotencyKey()
+}
+
+// Encode encodes the changeset into w and the spool file the first time, and copies the spool file
+// into w afterwards. A later Encode waits for an earlier one to finish.
+func (s *spooledChangeset) Encode(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		_, err := s.file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, s.file)
+		return err
+	}
+
+	file, err := os.CreateTemp("", "changeset-*.json")
+	if err != nil {
+		return err
+	}
+	tee := &spoolWriter{file: file, w: w}
+	err = s.changeset.Encode(tee)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+	s.file = file
+	return tee.err
+}
+
+// header returns the changeset's fields other than its changes, see changesetHeader. When the
+// changeset is not one that changesetHeader knows, they are read from the spool file.
+func (s *spooledChangeset) header() (*MetaChangeset, bool) {
+	if header, ok := changesetHeader(s.changeset); ok {
+		return header, true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil, false
+	}
+	_, err := s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, false
+	}
+	var header struct {
+		MetaChangeset
+		Changes skippedJSON `json:"changes"`
+	}
+	err = json.NewDecoder(s.file).Decode(&header)
+	if err != nil {
+		return nil, false
+	}
+	return &header.MetaChangeset, true
+}
+
+// Close removes the spool file.
+func (s *spooledChangeset) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	removeErr := os.Remove(s.file.Name())
+	s.file = nil
+	if err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// spoolWriter writes to the spool file, and to w until writing to w fails. It keeps writing to the
+// file after that, so that the spool file is complete even when the request is aborted.
+type spoolWriter struct {
+	file io.Writer
+	w    io.Writer
+	// The error writing to w
+	err error
+}
+
+func (t *spoolWriter) Write(p []byte) (int, error) {
+	n, err := t.file.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if t.err == nil {
+		_, t.err = t.w.Write(p)
+	}
+	return n, nil
+}
+
+// skippedJSON discards the JSON value it is decoded from.
+type skippedJSON struct{}
+
+func (skippedJSON) UnmarshalJSON([]byte) error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package publisher
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingEncoder counts how many times its changeset is encoded.
+type countingEncoder struct {
+	*MetaChangeset
+	encodes int32
+}
+
+func (c *countingEncoder) Encode(w io.Writer) error {
+	atomic.AddInt32(&c.encodes, 1)
+	return c.MetaChangeset.Encode(w)
+}
+
+func TestPublishEncodesStreamedChangesetOnceAcrossRetries(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		if len(bodies) < 3 {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = res.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	changeset := &countingEncoder{MetaChangeset: &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}}}
+
+	txt, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Retries: 2, InitialBackoff: time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", txt)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&changeset.encodes))
+	expected := new(bytes.Buffer)
+	assert.NoError(t, changeset.MetaChangeset.Encode(expected))
+	assert.Equal(t, []string{expected.String(), expected.String(), expected.String()}, bodies)
+}
+
+func TestPublishQueuesStreamedChangesetWithoutEncodingItAgain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	queue := NewQueue(t.TempDir())
+	metaChangeset := &MetaChangeset{Remote: "some-remote", UnixTime: 1644410531, OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}}
+	changeset := &countingEncoder{MetaChangeset: metaChangeset}
+
+	_, err := Publish(changeset, "org", server.URL, nil, &PublishOptions{Retries: 1, InitialBackoff: time.Millisecond, Queue: queue})
+	assert.True(t, errors.Is(err, ErrQueued))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&changeset.encodes))
+
+	files, err := queue.Files()
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		queued, err := ReadMetaChangesetFile(files[0])
+		assert.NoError(t, err)
+		assert.Equal(t, metaChangeset, queued)
+	}
+}
+
+func TestSpooledChangesetRemovesItsFile(t *testing.T) {
+	spool := &spooledChangeset{changeset: &MetaChangeset{Sha: "bbb"}}
+	assert.NoError(t, spool.Encode(io.Discard))
+	name := spool.file.Name()
+	assert.FileExists(t, name)
+
+	assert.NoError(t, spool.Close())
+	_, err := os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+}
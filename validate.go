@@ -0,0 +1,147 @@
+package publisher
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ChangesetSchema is the JSON Schema of the changesets Publish posts, which is version 1 of the
+// application/vnd.smartbear.onereport.changeset+json format.
+//
+//go:embed changeset.v1.schema.json
+var ChangesetSchema []byte
+
+// ValidationError lists the problems Validate found in a changeset.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return strings.Join(e, "\n")
+}
+
+var shaPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// Validate checks that the changeset is consistent with ChangesetSchema, by checking the values
+// against the constraints the schema places on them, and that its line mappings and counts are
+// consistent. It does not load the schema. Unknown fields cannot be represented in a MetaChangeset,
+// and are rejected by ReadMetaChangeset instead, and missing numbers cannot be told from zeros.
+// The error is a ValidationError.
+func (c *MetaChangeset) Validate() error {
+	var problems ValidationError
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Remote == "" {
+		addProblem("missing remote")
+	}
+	if c.Sha == "" {
+		addProblem("missing sha")
+	} else if !shaPattern.MatchString(c.Sha) {
+		addProblem("sha %q is not a commit sha", c.Sha)
+	}
+	if c.OldShas == nil {
+		addProblem("missing oldShas")
+	}
+	oldShas := make(map[string]bool, len(c.OldShas))
+	for _, oldSha := range c.OldShas {
+		if !shaPattern.MatchString(oldSha) {
+			addProblem("oldShas: %q is not a commit sha", oldSha)
+		}
+		oldShas[oldSha] = true
+	}
+	if c.Changes == nil {
+		addProblem("missing changes")
+	}
+	for i, change := range c.Changes {
+		for _, problem := range change.problems(oldShas) {
+			addProblem("changes[%d]: %s", i, problem)
+		}
+	}
+
+	if c.Loc < -1 {
+		addProblem("loc %d is less than -1", c.Loc)
+	}
+	if c.Files < 0 {
+		addProblem("files %d is negative", c.Files)
+	}
+	if c.OversizedFiles < 0 || c.OversizedFiles > c.Files {
+		addProblem("oversizedFiles %d is not between 0 and files %d", c.OversizedFiles, c.Files)
+	}
+	for _, problem := range logicalLinesProblems(c.Loc, c.CodeLoc, c.CommentLoc, c.BlankLoc) {
+		addProblem("%s", problem)
+	}
+	if c.Languages != nil {
+		loc, files := 0, 0
+		for language, features := range c.Languages {
+			if features.Loc < -1 {
+				addProblem("languages.%s: loc %d is less than -1", language, features.Loc)
+			}
+			if features.Files <= 0 {
+				addProblem("languages.%s: files %d is not positive", language, features.Files)
+			}
+			for _, problem := range logicalLinesProblems(features.Loc, features.CodeLoc, features.CommentLoc, features.BlankLoc) {
+				addProblem("languages.%s: %s", language, problem)
+			}
+			loc += features.Loc
+			files += features.Files
+		}
+		if files != c.Files {
+			addProblem("the files of the languages add up to %d, not files %d", files, c.Files)
+		}
+		if c.Loc >= 0 && loc != c.Loc {
+			addProblem("the loc of the languages add up to %d, not loc %d", loc, c.Loc)
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func (change *Change) problems(oldShas map[string]bool) []string {
+	var problems []string
+	if !shaPattern.MatchString(change.OldSha) {
+		problems = append(problems, fmt.Sprintf("oldSha %q is not a commit sha", change.OldSha))
+	} else if len(oldShas) > 0 && !oldShas[change.OldSha] {
+		problems = append(problems, fmt.Sprintf("oldSha %q is not in oldShas", change.OldSha))
+	}
+	if change.OldPath == "" && change.NewPath == "" {
+		problems = append(problems, "missing both oldPath and newPath")
+	}
+	if change.LineMappings == nil {
+		problems = append(problems, "missing lineMappings")
+	}
+	if (change.Binary || change.Oversized) && len(change.LineMappings) > 0 {
+		problems = append(problems, "a binary or oversized file has lineMappings")
+	}
+	for i, mapping := range change.LineMappings {
+		if len(mapping) != 2 {
+			problems = append(problems, fmt.Sprintf("lineMappings[%d] %v is not an [oldLine, newLine] pair", i, mapping))
+			continue
+		}
+		if mapping[0] < -1 || mapping[1] < -1 || (mapping[0] == -1 && mapping[1] == -1) {
+			problems = append(problems, fmt.Sprintf("lineMappings[%d] %v has invalid line numbers", i, mapping))
+		}
+		if mapping[0] >= 0 && change.OldPath == "" {
+			problems = append(problems, fmt.Sprintf("lineMappings[%d] %v maps from an added file", i, mapping))
+		}
+		if mapping[1] >= 0 && change.NewPath == "" {
+			problems = append(problems, fmt.Sprintf("lineMappings[%d] %v maps to a deleted file", i, mapping))
+		}
+	}
+	return problems
+}
+
+// logicalLinesProblems checks that code, comment and blank lines, when counted, add up to loc.
+func logicalLinesProblems(loc int, code int, comment int, blank int) []string {
+	if code < 0 || comment < 0 || blank < 0 {
+		return []string{fmt.Sprintf("codeLoc %d, commentLoc %d or blankLoc %d is negative", code, comment, blank)}
+	}
+	if code+comment+blank != 0 && code+comment+blank != loc {
+		return []string{fmt.Sprintf("codeLoc %d, commentLoc %d and blankLoc %d do not add up to loc %d", code, comment, blank, loc)}
+	}
+	return nil
+}
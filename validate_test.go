@@ -0,0 +1,212 @@
+package publisher
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type schemaObject struct {
+	Required   []string                   `json:"required"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+// jsonFields returns the JSON field names of a struct, and those that are always present.
+func jsonFields(t reflect.Type) ([]string, []string) {
+	var fields, required []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, tag[0])
+		if len(tag) == 1 {
+			required = append(required, tag[0])
+		}
+	}
+	sort.Strings(fields)
+	sort.Strings(required)
+	return fields, required
+}
+
+func TestChangesetSchemaMatchesTypes(t *testing.T) {
+	var schema struct {
+		schemaObject
+		Defs map[string]schemaObject `json:"$defs"`
+	}
+	assert.NoError(t, json.Unmarshal(ChangesetSchema, &schema))
+
+	for _, test := range []struct {
+		object schemaObject
+		t      reflect.Type
+	}{
+		{schema.schemaObject, reflect.TypeOf(MetaChangeset{})},
+		{schema.Defs["change"], reflect.TypeOf(Change{})},
+		{schema.Defs["languageFeatures"], reflect.TypeOf(LanguageFeatures{})},
+	} {
+		fields, required := jsonFields(test.t)
+		var properties []string
+		for property := range test.object.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+		sort.Strings(test.object.Required)
+		assert.Equal(t, fields, properties, test.t.Name())
+		assert.Equal(t, required, test.object.Required, test.t.Name())
+	}
+}
+
+func validChangeset() *MetaChangeset {
+	return &MetaChangeset{
+		Remote:   "some-remote",
+		UnixTime: 1644410531,
+		OldShas:  []string{"ad2c70149ccc529ab26588cde2af1312e6aa0c06"},
+		Sha:      "1ae2aabbcdd11948403578a4f2dd32911cc48a00",
+		Changes: []Change{
+			{OldSha: "ad2c70149ccc529ab26588cde2af1312e6aa0c06", OldPath: "a.txt", NewPath: "a.txt", LineMappings: [][]int{{0, 0}, {1, -1}, {-1, 1}}},
+			{OldSha: "ad2c70149ccc529ab26588cde2af1312e6aa0c06", OldPath: "", NewPath: "b.png", LineMappings: [][]int{}, Binary: true},
+		},
+		Loc:        10,
+		Files:      2,
+		CodeLoc:    7,
+		CommentLoc: 2,
+		BlankLoc:   1,
+		Languages: map[string]LanguageFeatures{
+			"Go":    {Loc: 10, Files: 1, CodeLoc: 7, CommentLoc: 2, BlankLoc: 1},
+			"Other": {Loc: 0, Files: 1},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, validChangeset().Validate())
+	assert.NoError(t, (&MetaChangeset{Remote: "r", OldShas: []string{}, Sha: "1ae2aabbcdd11948403578a4f2dd32911cc48a00", Changes: []Change{}, Loc: -1}).Validate())
+}
+
+// schemaProperty holds the constraints ChangesetSchema places on a value.
+type schemaProperty struct {
+	Ref       string          `json:"$ref"`
+	Minimum   *float64        `json:"minimum"`
+	MinLength *int            `json:"minLength"`
+	Pattern   string          `json:"pattern"`
+	Items     *schemaProperty `json:"items"`
+	MinItems  *int            `json:"minItems"`
+	MaxItems  *int            `json:"maxItems"`
+}
+
+// breakValue returns copies of value that each break one of the constraints of property.
+func breakValue(t *testing.T, value interface{}, property schemaProperty, defs map[string]json.RawMessage) map[string]interface{} {
+	broken := make(map[string]interface{})
+	if property.Ref != "" {
+		var def schemaProperty
+		assert.NoError(t, json.Unmarshal(defs[strings.TrimPrefix(property.Ref, "#/$defs/")], &def))
+		return breakValue(t, value, def, defs)
+	}
+	if property.Minimum != nil {
+		broken["minimum"] = *property.Minimum - 1
+	}
+	if property.MinLength != nil {
+		broken["minLength"] = strings.Repeat("x", *property.MinLength-1)
+	}
+	if property.Pattern != "" {
+		broken["pattern"] = "-"
+	}
+	items, _ := value.([]interface{})
+	if property.Items != nil && len(items) > 0 {
+		for constraint, item := range breakValue(t, items[0], *property.Items, defs) {
+			brokenItems := append([]interface{}{item}, items[1:]...)
+			broken["items."+constraint] = brokenItems
+		}
+	}
+	if property.MinItems != nil {
+		broken["minItems"] = items[:*property.MinItems-1]
+	}
+	if property.MaxItems != nil {
+		tooMany := append([]interface{}{}, items...)
+		for len(tooMany) <= *property.MaxItems {
+			tooMany = append(tooMany, items[0])
+		}
+		broken["maxItems"] = tooMany
+	}
+	return broken
+}
+
+// TestValidateEnforcesSchemaConstraints breaks each constraint on a value in ChangesetSchema in turn,
+// and checks that Validate rejects the changeset.
+func TestValidateEnforcesSchemaConstraints(t *testing.T) {
+	var schema struct {
+		schemaObject
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	assert.NoError(t, json.Unmarshal(ChangesetSchema, &schema))
+	var change, languageFeatures schemaObject
+	assert.NoError(t, json.Unmarshal(schema.Defs["change"], &change))
+	assert.NoError(t, json.Unmarshal(schema.Defs["languageFeatures"], &languageFeatures))
+
+	for _, test := range []struct {
+		path   string
+		object schemaObject
+		find   func(changeset map[string]interface{}) map[string]interface{}
+	}{
+		{"", schema.schemaObject, func(changeset map[string]interface{}) map[string]interface{} {
+			return changeset
+		}},
+		{"changes[0].", change, func(changeset map[string]interface{}) map[string]interface{} {
+			return changeset["changes"].([]interface{})[0].(map[string]interface{})
+		}},
+		{"languages.Go.", languageFeatures, func(changeset map[string]interface{}) map[string]interface{} {
+			return changeset["languages"].(map[string]interface{})["Go"].(map[string]interface{})
+		}},
+	} {
+		for name, raw := range test.object.Properties {
+			var property schemaProperty
+			assert.NoError(t, json.Unmarshal(raw, &property))
+			var valid map[string]interface{}
+			j, err := json.Marshal(validChangeset())
+			assert.NoError(t, err)
+			assert.NoError(t, json.Unmarshal(j, &valid))
+
+			for constraint, value := range breakValue(t, test.find(valid)[name], property, schema.Defs) {
+				t.Run(test.path+name+" "+constraint, func(t *testing.T) {
+					var document map[string]interface{}
+					assert.NoError(t, json.Unmarshal(j, &document))
+					test.find(document)[name] = value
+					j, err := json.Marshal(document)
+					assert.NoError(t, err)
+					changeset := &MetaChangeset{}
+					assert.NoError(t, json.Unmarshal(j, changeset))
+					err = changeset.Validate()
+					if assert.Error(t, err) {
+						assert.Contains(t, err.Error(), name)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestValidateInvalidChangesets(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		change   func(c *MetaChangeset)
+		expected string
+	}{
+		{"short sha", func(c *MetaChangeset) { c.Sha = "1ae2aab" }, `sha "1ae2aab" is not a commit sha`},
+		{"unknown oldSha", func(c *MetaChangeset) { c.Changes[0].OldSha = "e57bfde5c3591a14c0e199c900174a08b0b94312" }, `changes[0]: oldSha "e57bfde5c3591a14c0e199c900174a08b0b94312" is not in oldShas`},
+		{"no paths", func(c *MetaChangeset) { c.Changes[1].NewPath = "" }, "changes[1]: missing both oldPath and newPath"},
+		{"mapping triple", func(c *MetaChangeset) { c.Changes[0].LineMappings[0] = []int{0, 0, 0} }, "changes[0]: lineMappings[0] [0 0 0] is not an [oldLine, newLine] pair"},
+		{"mapping of no lines", func(c *MetaChangeset) { c.Changes[0].LineMappings[0] = []int{-1, -1} }, "changes[0]: lineMappings[0] [-1 -1] has invalid line numbers"},
+		{"mapping from added file", func(c *MetaChangeset) { c.Changes[0].OldPath = "" }, "changes[0]: lineMappings[0] [0 0] maps from an added file\nchanges[0]: lineMappings[1] [1 -1] maps from an added file"},
+		{"binary with mappings", func(c *MetaChangeset) { c.Changes[1].Binary = false; c.Changes[0].Binary = true }, "changes[0]: a binary or oversized file has lineMappings"},
+		{"too many oversized files", func(c *MetaChangeset) { c.OversizedFiles = 3 }, "oversizedFiles 3 is not between 0 and files 2"},
+		{"inconsistent logical lines", func(c *MetaChangeset) { c.BlankLoc = 5 }, "codeLoc 7, commentLoc 2 and blankLoc 5 do not add up to loc 10"},
+		{"inconsistent language files", func(c *MetaChangeset) { c.Files = 3 }, "the files of the languages add up to 2, not files 3"},
+		{"inconsistent language loc", func(c *MetaChangeset) { c.Loc, c.CodeLoc = 11, 8 }, "the loc of the languages add up to 10, not loc 11"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			changeset := validChangeset()
+			test.change(changeset)
+			assert.EqualError(t, changeset.Validate(), test.expected)
+		})
+	}
+}